@@ -0,0 +1,223 @@
+// Package cfg splits a .text image into basic blocks and builds its control
+// flow graph. Branches are not delayed (MARS default), so a block ends at the
+// branch or jump itself. jal and the linking branches are resolved to call
+// edges, and each jr $ra is connected back to the return sites of the calls
+// into its function.
+package cfg
+
+import (
+	"sort"
+
+	"hex2mips/disassembler"
+)
+
+// EdgeKind classifies a control flow edge.
+type EdgeKind string
+
+const (
+	Fall   EdgeKind = "fall"   // sequential execution, including the return site after a call
+	Branch EdgeKind = "branch" // taken conditional branch
+	Jump   EdgeKind = "jump"   // j, or a branch that is always taken
+	Call   EdgeKind = "call"   // jal, bltzal, bgezal
+	Return EdgeKind = "return" // jr $ra back to a return site
+)
+
+// Edge is a control flow edge between block start addresses. To may lie
+// outside the image when a branch or jump leaves it.
+type Edge struct {
+	From, To uint32
+	Kind     EdgeKind
+}
+
+// Block is a maximal straight-line run of instructions.
+type Block struct {
+	Name       string
+	Start, End uint32 // [Start, End)
+	Words      []uint32
+	Func       string // name of the function the block belongs to, empty when unreachable
+	Returns    bool   // ends in jr $ra
+	Indirect   bool   // ends in jr through another register or jalr
+}
+
+// Func is a function: the blocks reachable from an entry without following
+// calls. The whole image's base is the first entry, every call target another.
+type Func struct {
+	Name    string
+	Entry   uint32
+	Blocks  []uint32 // block start addresses
+	Returns []uint32 // blocks ending in jr $ra
+}
+
+// Graph is the control flow graph of an image.
+type Graph struct {
+	Base   uint32
+	Blocks []*Block
+	Edges  []Edge
+	Funcs  []*Func
+}
+
+// Block returns the block starting at addr.
+func (g *Graph) Block(addr uint32) *Block {
+	i := sort.Search(len(g.Blocks), func(i int) bool { return g.Blocks[i].Start >= addr })
+	if i < len(g.Blocks) && g.Blocks[i].Start == addr {
+		return g.Blocks[i]
+	}
+	return nil
+}
+
+// Build builds the graph of words loaded at base. names gives labels for
+// addresses, such as the symbols of an assembled source; other block and
+// function names are synthesized with disassembler.Label.
+func Build(words []uint32, base uint32, names map[uint32]string) *Graph {
+	g := &Graph{Base: base}
+	end := base + uint32(len(words))*4
+	inside := func(addr uint32) bool { return addr >= base && addr < end && addr&3 == 0 }
+	name := func(addr uint32) string {
+		if n, ok := names[addr]; ok {
+			return n
+		}
+		return disassembler.Label(addr)
+	}
+	if len(words) == 0 {
+		return g
+	}
+
+	leaders := map[uint32]bool{base: true}
+	for i, w := range words {
+		pc := base + uint32(i)*4
+		if dest, ok := disassembler.Target(w, pc); ok && inside(dest) {
+			leaders[dest] = true
+		}
+		if ends(w) && pc+4 < end {
+			leaders[pc+4] = true
+		}
+	}
+	for i, w := range words {
+		pc := base + uint32(i)*4
+		if leaders[pc] {
+			g.Blocks = append(g.Blocks, &Block{Name: name(pc), Start: pc})
+		}
+		b := g.Blocks[len(g.Blocks)-1]
+		b.Words = append(b.Words, w)
+		b.End = pc + 4
+	}
+
+	var calls []Edge
+	for _, b := range g.Blocks {
+		last := b.Words[len(b.Words)-1]
+		pc := b.End - 4
+		edge := func(to uint32, kind EdgeKind) {
+			if kind == Fall && to >= end {
+				return
+			}
+			e := Edge{From: b.Start, To: to, Kind: kind}
+			g.Edges = append(g.Edges, e)
+			if kind == Call {
+				calls = append(calls, e)
+			}
+		}
+		in := disassembler.Decode(last, pc)
+		if !in.Known() {
+			edge(b.End, Fall)
+			continue
+		}
+		switch in.Mnemonic {
+		case "j":
+			edge(in.Target, Jump)
+		case "jal", "bltzal", "bgezal":
+			edge(in.Target, Call)
+			edge(b.End, Fall)
+		case "jr":
+			b.Returns = in.Fields.Rs == 31
+			b.Indirect = !b.Returns
+		case "jalr":
+			b.Indirect = true
+			edge(b.End, Fall)
+		case "eret":
+		default:
+			switch {
+			case always(in):
+				edge(in.Target, Jump)
+			case in.Branch:
+				edge(in.Target, Branch)
+				edge(b.End, Fall)
+			default:
+				edge(b.End, Fall)
+			}
+		}
+	}
+
+	// Entries are the base and every call target. A block belongs to the first
+	// function, in entry order, that reaches it; the walk stops at other entries.
+	entries := []uint32{base}
+	seen := map[uint32]bool{base: true}
+	for _, e := range calls {
+		if inside(e.To) && !seen[e.To] {
+			seen[e.To] = true
+			entries = append(entries, e.To)
+		}
+	}
+	sort.Slice(entries[1:], func(i, j int) bool { return entries[i+1] < entries[j+1] })
+	succs := map[uint32][]uint32{}
+	for _, e := range g.Edges {
+		if e.Kind != Call && inside(e.To) {
+			succs[e.From] = append(succs[e.From], e.To)
+		}
+	}
+	funcs := map[uint32]*Func{}
+	for _, entry := range entries {
+		fn := &Func{Name: name(entry), Entry: entry}
+		funcs[entry] = fn
+		g.Funcs = append(g.Funcs, fn)
+		for work := []uint32{entry}; len(work) > 0; {
+			b := g.Block(work[len(work)-1])
+			work = work[:len(work)-1]
+			if b.Func != "" || (b.Start != entry && seen[b.Start]) {
+				continue
+			}
+			b.Func = fn.Name
+			fn.Blocks = append(fn.Blocks, b.Start)
+			if b.Returns {
+				fn.Returns = append(fn.Returns, b.Start)
+			}
+			work = append(work, succs[b.Start]...)
+		}
+		sort.Slice(fn.Blocks, func(i, j int) bool { return fn.Blocks[i] < fn.Blocks[j] })
+		sort.Slice(fn.Returns, func(i, j int) bool { return fn.Returns[i] < fn.Returns[j] })
+	}
+
+	// Each jr $ra returns to the instruction after every call into its function
+	for _, c := range calls {
+		fn := funcs[c.To]
+		site := g.Block(c.From).End
+		if fn == nil || site >= end {
+			continue
+		}
+		for _, r := range fn.Returns {
+			g.Edges = append(g.Edges, Edge{From: r, To: site, Kind: Return})
+		}
+	}
+	return g
+}
+
+// ends reports whether w transfers control, ending its block.
+func ends(w uint32) bool {
+	in := disassembler.Decode(w, 0)
+	switch in.Mnemonic {
+	case "jr", "jalr", "eret":
+		return true
+	}
+	return in.Branch
+}
+
+// always reports whether a conditional branch is always taken, such as
+// beq $zero, $zero (the pseudo-instruction b) or bgez $zero.
+func always(in disassembler.Instruction) bool {
+	switch in.Mnemonic {
+	case "beq":
+		return in.Fields.Rs == in.Fields.Rt
+	case "bgez", "blez":
+		return in.Fields.Rs == 0
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package cfg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mips2hex/assembler"
+)
+
+func TestBuild(t *testing.T) {
+	src := strings.Join([]string{
+		".text",
+		"main: li $a0, 3",
+		"jal f",
+		"jal f",
+		"li $v0, 10",
+		"syscall",
+		"f: beqz $a0, done",
+		"addi $a0, $a0, -1",
+		"b f",
+		"done: jr $ra",
+	}, "\n")
+	layout := assembler.Layout{TextBase: 0x3000}
+	prog, diags := assembler.AssembleSource(src, assembler.Options{File: "cfg.s", Layout: layout})
+	if len(diags) != 0 {
+		t.Fatalf("assemble: %v", diags)
+	}
+	names := map[uint32]string{}
+	for _, s := range prog.Symbols {
+		names[s.Addr] = s.Name
+	}
+	g := Build(prog.Text, 0x3000, names)
+
+	var blocks []string
+	for _, b := range g.Blocks {
+		blocks = append(blocks, fmt.Sprintf("%s[%x,%x)%s", b.Name, b.Start, b.End, b.Func))
+	}
+	want := "main[3000,3008)main L_3008[3008,300c)main L_300c[300c,3014)main f[3014,3018)f L_3018[3018,3020)f done[3020,3024)f"
+	if strings.Join(blocks, " ") != want {
+		t.Errorf("blocks:\n%s\nwant:\n%s", strings.Join(blocks, " "), want)
+	}
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, fmt.Sprintf("%x-%s->%x", e.From, e.Kind, e.To))
+	}
+	want = "3000-call->3014 3000-fall->3008 3008-call->3014 3008-fall->300c 300c-fall->3014 " +
+		"3014-branch->3020 3014-fall->3018 3018-jump->3014 3020-return->3008 3020-return->300c"
+	if strings.Join(edges, " ") != want {
+		t.Errorf("edges:\n%s\nwant:\n%s", strings.Join(edges, " "), want)
+	}
+	if len(g.Funcs) != 2 || fmt.Sprint(g.Funcs[1].Returns) != "[12320]" {
+		t.Errorf("funcs: %+v %+v", g.Funcs[0], g.Funcs[1])
+	}
+
+	var dot strings.Builder
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`label="f";`, `"done" -> "L_3008" [label="return", style=dotted];`, `"main" -> "f" [label="call", style=dashed];`} {
+		if !strings.Contains(dot.String(), s) {
+			t.Errorf("DOT output lacks %s:\n%s", s, dot.String())
+		}
+	}
+	var js strings.Builder
+	if err := g.WriteJSON(&js); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(js.String(), `"from": "done",`) || !strings.Contains(js.String(), `"returns": [
+        "done"
+      ]`) {
+		t.Errorf("JSON output:\n%s", js.String())
+	}
+}
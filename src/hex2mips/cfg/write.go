@@ -0,0 +1,126 @@
+package cfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"hex2mips/disassembler"
+)
+
+// node returns the DOT node id of addr: the block name, or the address for
+// destinations outside the image.
+func (g *Graph) node(addr uint32) string {
+	if b := g.Block(addr); b != nil {
+		return b.Name
+	}
+	return fmt.Sprintf("0x%08x", addr)
+}
+
+// WriteDOT writes the graph in Graphviz DOT. Each function is a cluster;
+// call edges are dashed and return edges dotted.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph cfg {\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	block := func(indent string, blk *Block) {
+		var label strings.Builder
+		label.WriteString(blk.Name + ":\\l")
+		for i, word := range blk.Words {
+			pc := blk.Start + uint32(i)*4
+			fmt.Fprintf(&label, "0x%08x: %s\\l", pc, disassembler.DecodeWord(word, pc))
+		}
+		fmt.Fprintf(&b, "%s%q [label=\"%s\"];\n", indent, blk.Name, label.String())
+	}
+	for i, fn := range g.Funcs {
+		fmt.Fprintf(&b, "\tsubgraph cluster_%d {\n\t\tlabel=%q;\n", i, fn.Name)
+		for _, start := range fn.Blocks {
+			block("\t\t", g.Block(start))
+		}
+		b.WriteString("\t}\n")
+	}
+	for _, blk := range g.Blocks {
+		if blk.Func == "" {
+			block("\t", blk)
+		}
+	}
+	external := map[uint32]bool{}
+	for _, e := range g.Edges {
+		if g.Block(e.To) == nil && !external[e.To] {
+			external[e.To] = true
+			fmt.Fprintf(&b, "\t%q [shape=plaintext];\n", g.node(e.To))
+		}
+	}
+	for _, e := range g.Edges {
+		attrs := fmt.Sprintf("label=%q", string(e.Kind))
+		switch e.Kind {
+		case Call:
+			attrs += ", style=dashed"
+		case Return:
+			attrs += ", style=dotted"
+		}
+		fmt.Fprintf(&b, "\t%q -> %q [%s];\n", g.node(e.From), g.node(e.To), attrs)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type jsonBlock struct {
+	Name         string   `json:"name"`
+	Start        uint32   `json:"start"`
+	End          uint32   `json:"end"`
+	Func         string   `json:"func"`
+	Returns      bool     `json:"returns,omitempty"`
+	Indirect     bool     `json:"indirect,omitempty"`
+	Instructions []string `json:"instructions"`
+}
+
+type jsonEdge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+type jsonFunc struct {
+	Name    string   `json:"name"`
+	Entry   uint32   `json:"entry"`
+	Blocks  []string `json:"blocks"`
+	Returns []string `json:"returns"`
+}
+
+// WriteJSON writes the graph as one JSON object with "functions", "blocks"
+// and "edges". Addresses are numbers; edges refer to blocks by name, and to
+// destinations outside the image by "0x%08x".
+func (g *Graph) WriteJSON(w io.Writer) error {
+	out := struct {
+		Base      uint32      `json:"base"`
+		Functions []jsonFunc  `json:"functions"`
+		Blocks    []jsonBlock `json:"blocks"`
+		Edges     []jsonEdge  `json:"edges"`
+	}{Base: g.Base, Functions: []jsonFunc{}, Blocks: []jsonBlock{}, Edges: []jsonEdge{}}
+	names := func(addrs []uint32) []string {
+		s := []string{}
+		for _, a := range addrs {
+			s = append(s, g.node(a))
+		}
+		return s
+	}
+	for _, fn := range g.Funcs {
+		out.Functions = append(out.Functions, jsonFunc{fn.Name, fn.Entry, names(fn.Blocks), names(fn.Returns)})
+	}
+	for _, blk := range g.Blocks {
+		jb := jsonBlock{Name: blk.Name, Start: blk.Start, End: blk.End, Func: blk.Func, Returns: blk.Returns, Indirect: blk.Indirect}
+		for i, word := range blk.Words {
+			jb.Instructions = append(jb.Instructions, disassembler.DecodeWord(word, blk.Start+uint32(i)*4))
+		}
+		out.Blocks = append(out.Blocks, jb)
+	}
+	for _, e := range g.Edges {
+		out.Edges = append(out.Edges, jsonEdge{g.node(e.From), g.node(e.To), e.Kind})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
@@ -0,0 +1,71 @@
+package disassembler
+
+import (
+	"strings"
+	"testing"
+
+	"isa"
+)
+
+func TestExtendedInstructions(t *testing.T) {
+	// word and its disassembly at PC 0x3000
+	cases := []struct {
+		word uint32
+		want string
+	}{
+		{0x0500ffff, "bltz $t0, 0x00003000"},
+		{0x0501ffff, "bgez $t0, 0x00003000"},
+		{0x0510ffff, "bltzal $t0, 0x00003000"},
+		{0x0491ffff, "bgezal $a0, 0x00003000"},
+		{0x0000000c, "syscall"},
+		{0x0000000d, "break"},
+		{0x000001cd, "break 7"},
+		{0x42000018, "eret"},
+		{0x401a7000, "mfc0 $k0, $14"},
+		{0x40886000, "mtc0 $t0, $12"},
+		{0x012a400a, "movz $t0, $t1, $t2"},
+		{0x012a400b, "movn $t0, $t1, $t2"},
+		{0x71204020, "clz $t0, $t1"},
+		{0x71204021, "clo $t0, $t1"},
+		{0x71090000, "madd $t0, $t1"},
+		{0x71090001, "maddu $t0, $t1"},
+		{0x71090004, "msub $t0, $t1"},
+		{0x71090005, "msubu $t0, $t1"},
+		{0x712a4002, "mul $t0, $t1, $t2"},
+		{0x89280003, "lwl $t0, 3($t1)"},
+		{0x99280000, "lwr $t0, 0($t1)"},
+		{0xa9280003, "swl $t0, 3($t1)"},
+		{0xb9280000, "swr $t0, 0($t1)"},
+		{0x01090034, "teq $t0, $t1"},
+		{0x01090036, "tne $t0, $t1"},
+		{0x01090030, "tge $t0, $t1"},
+		{0x01090031, "tgeu $t0, $t1"},
+		{0x01090032, "tlt $t0, $t1"},
+		{0x01090033, "tltu $t0, $t1"},
+		{0x050cffff, "teqi $t0, -1"},
+		{0x050e0005, "tnei $t0, 5"},
+		{0x05080005, "tgei $t0, 5"},
+		{0x05090005, "tgeiu $t0, 5"},
+		{0x050a0005, "tlti $t0, 5"},
+		{0x050b0005, "tltiu $t0, 5"},
+	}
+	for _, c := range cases {
+		if got := DecodeWord(c.word, 0x3000); got != c.want {
+			t.Errorf("%08x disassembles to %q, want %q", c.word, got, c.want)
+		}
+	}
+}
+
+// TestISACoverage checks that every instruction in the isa table disassembles
+// to its own mnemonic.
+func TestISACoverage(t *testing.T) {
+	for i := range isa.Instructions {
+		s := &isa.Instructions[i]
+		// rs=$t1, rt=$t2, rd=$t0, shamt=3, imm=4
+		w := s.Match | (9<<21|10<<16|8<<11|3<<6|4)&s.Syntax.Operands()
+		in := Decode(w, 0x3000)
+		if in.Mnemonic != s.Name || strings.Fields(in.String())[0] != s.Name {
+			t.Errorf("%s: %08x disassembles to %q", s.Name, w, in)
+		}
+	}
+}
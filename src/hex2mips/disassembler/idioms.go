@@ -0,0 +1,98 @@
+package disassembler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line is one line of a listing: a single instruction, or a pseudo-instruction
+// covering the consecutive words it was expanded from.
+type Line struct {
+	PC    uint32
+	Words []uint32
+	Text  string
+}
+
+// Idioms disassembles words loaded at base in style st, printing the
+// expansions the assembler generates for common pseudo-instructions as the
+// pseudo-instructions themselves:
+//
+//	lui $at, X; ori rd, $at, Y      li rd, 0xXXXXYYYY, or la rd, label when
+//	                                data names that address
+//	addi rd, $zero, Y               li rd, Y, or la rd, label (the compact la)
+//	addiu rd, $zero, Y              li rd, Y
+//	ori rd, $zero, Y                li rd, Y
+//	addu rd, rs, $zero (or $zero, rs)  move rd, rs
+//	beq $zero, $zero, L             b L
+//	bgez $zero, L                   b L (the expansion MARS uses)
+//
+// Only the forms la expands to are named from data, so small constants are
+// not mistaken for addresses near a zero .data base. A pair is only merged
+// when no branch or jump lands on its second word, and words with nonzero
+// unused fields are never treated as an expansion. Everything else is
+// rendered as by Instruction.Render.
+func Idioms(words []uint32, base uint32, st Style, data map[uint32]string) []Line {
+	insts := make([]Instruction, len(words))
+	targets := map[uint32]bool{}
+	for i, w := range words {
+		insts[i] = Decode(w, base+uint32(i)*4)
+		if insts[i].Branch {
+			targets[insts[i].Target] = true
+		}
+	}
+	pseudo := func(name string, ops ...string) string {
+		return name + st.OpSep + strings.Join(ops, st.Sep)
+	}
+	// li renders an address load as la when data names the value
+	li := func(rd, value uint32, text string) string {
+		if name, ok := data[value]; ok {
+			return pseudo("la", st.reg(rd), name)
+		}
+		return pseudo("li", st.reg(rd), text)
+	}
+
+	var out []Line
+	for i := 0; i < len(insts); i++ {
+		in, start := insts[i], i
+		line := Line{PC: in.PC, Words: []uint32{in.Word}}
+		f := in.Fields
+		switch {
+		case !in.Known() || !in.Spec.Canonical(in.Word):
+			// not something the assembler generates
+		case in.Mnemonic == "lui" && f.Rt == 1:
+			if i+1 == len(insts) || targets[insts[i+1].PC] {
+				break
+			}
+			next := insts[i+1]
+			if next.Mnemonic != "ori" || next.Fields.Rs != 1 || !next.Spec.Canonical(next.Word) {
+				break
+			}
+			value := f.Imm<<16 | next.Fields.Imm
+			line.Text = li(next.Fields.Rt, value, fmt.Sprintf("0x%08x", value))
+			line.Words = append(line.Words, next.Word)
+			i++
+		case in.Mnemonic == "addiu" && f.Rs == 0:
+			line.Text = pseudo("li", st.reg(f.Rt), st.imm(int64(signExtend16(f.Imm))))
+		case in.Mnemonic == "ori" && f.Rs == 0:
+			line.Text = pseudo("li", st.reg(f.Rt), st.uimm(int64(f.Imm)))
+		case in.Mnemonic == "addi" && f.Rs == 0:
+			v := signExtend16(f.Imm)
+			line.Text = li(f.Rt, uint32(v), st.imm(int64(v)))
+		case in.Mnemonic == "addu" && (f.Rt == 0 || f.Rs == 0):
+			line.Text = pseudo("move", st.reg(f.Rd), st.reg(f.Rs|f.Rt))
+		case in.Mnemonic == "beq" && f.Rs == 0 && f.Rt == 0, in.Mnemonic == "bgez" && f.Rs == 0:
+			line.Text = pseudo("b", st.target(in.Spec, in.Word, in.PC, in.Target))
+		}
+		if line.Text == "" {
+			line.Text = in.Render(st)
+		} else if st.Fields {
+			var fs []string
+			for _, w := range insts[start : i+1] {
+				fs = append(fs, fields(w))
+			}
+			line.Text += "\t# " + strings.Join(fs, "; ")
+		}
+		out = append(out, line)
+	}
+	return out
+}
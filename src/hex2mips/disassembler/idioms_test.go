@@ -0,0 +1,104 @@
+package disassembler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mips2hex/assembler"
+	"mips2hex/types"
+)
+
+func TestIdioms(t *testing.T) {
+	src := strings.Join([]string{
+		".data",
+		"arr: .word 1, 2, 3",
+		".text",
+		"main: la $t0, arr",
+		"li $t1, 0x12345678",
+		"move $t2, $t1",
+		"addu $t2, $zero, $t1",
+		"b main",
+		"beq $zero, $zero, main",
+		"addu $t3, $t4, $t5",
+		"lui $at, 0x1234",
+		"mid: ori $t4, $at, 0x5678",
+		"beq $t0, $t0, mid",
+	}, "\n")
+	layout := assembler.Layout{TextBase: 0x3000, DataBase: 0x10010000}
+	prog, diags := assembler.AssembleSource(src, assembler.Options{File: "idioms.s", Layout: layout})
+	if len(diags) != 0 {
+		t.Fatalf("assemble: %v", diags)
+	}
+	data := map[uint32]string{}
+	for _, s := range prog.Symbols {
+		if s.Seg == types.Data {
+			data[s.Addr] = s.Name
+		}
+	}
+	var got []string
+	for _, l := range Idioms(prog.Text, 0x3000, DefaultStyle, data) {
+		got = append(got, fmt.Sprintf("%x:%d %s", l.PC, len(l.Words), l.Text))
+	}
+	want := []string{
+		"3000:2 la $t0, arr",
+		"3008:2 li $t1, 0x12345678",
+		"3010:1 move $t2, $t1",
+		"3014:1 move $t2, $t1",
+		"3018:1 b 0x00003000",
+		"301c:1 b 0x00003000",
+		"3020:1 addu $t3, $t4, $t5",
+		// a branch lands on the ori, so the pair is not merged
+		"3024:1 lui $at, 0x1234",
+		"3028:1 ori $t4, $at, 0x5678",
+		"302c:1 beq $t0, $t0, 0x00003028",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	// Without symbols the la expansion shows as li
+	lines := Idioms(prog.Text[:2], 0x3000, ObjdumpStyle, nil)
+	if len(lines) != 1 || lines[0].Text != "li\tt0,0x10010000" {
+		t.Errorf("la expansion renders as %+v", lines)
+	}
+
+	// The compact expansions, at a .data base of 0 as in the course layout.
+	// A lui without $at is never generated, nor is the hand-written pair, and
+	// the addu has a nonzero shamt, so it is not the move expansion.
+	src = strings.Join([]string{
+		".data",
+		"pad: .word 0",
+		"buf: .word 0",
+		".text",
+		"li $t0, 0",
+		"li $t1, -5",
+		"li $t2, 0xffff",
+		"li $t3, 4",
+		"la $t4, buf",
+		"lui $t5, 0x1000",
+		"ori $t5, $t5, 0x5678",
+		".word 0x01404861",
+	}, "\n")
+	prog, diags = assembler.AssembleSource(src, assembler.Options{File: "compact.s", Layout: assembler.Layout{TextBase: 0x3000}})
+	if len(diags) != 0 {
+		t.Fatalf("assemble: %v", diags)
+	}
+	data = map[uint32]string{0: "pad", 4: "buf"}
+	got = nil
+	for _, l := range Idioms(prog.Text, 0x3000, DefaultStyle, data) {
+		got = append(got, fmt.Sprintf("%x:%d %s", l.PC, len(l.Words), l.Text))
+	}
+	want = []string{
+		"3000:1 li $t0, 0",
+		"3004:1 li $t1, -5",
+		"3008:1 li $t2, 0xffff",
+		"300c:1 li $t3, 4",
+		"3010:1 la $t4, buf",
+		"3014:1 lui $t5, 0x1000",
+		"3018:1 ori $t5, $t5, 0x5678",
+		"301c:1 addu $t1, $t2, $zero",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,135 @@
+package disassembler
+
+import "isa"
+
+// Format is the encoding format of an instruction word.
+type Format int
+
+const (
+	FormatR Format = iota // SPECIAL, SPECIAL2 and COP0 register forms
+	FormatI
+	FormatJ
+)
+
+func (f Format) String() string {
+	return [...]string{"R", "I", "J"}[f]
+}
+
+// OperandKind is the kind of an operand as written in assembly.
+type OperandKind int
+
+const (
+	OpReg    OperandKind = iota // general purpose register, in Reg
+	OpCopReg                    // coprocessor 0 register number, in Reg
+	OpImm                       // signed or small unsigned value (offsets, shift amounts, break codes), in Imm
+	OpUImm                      // zero-extended 16-bit immediate of andi/ori/xori/lui, in Imm
+	OpMem                       // Imm(Reg)
+	OpTarget                    // branch or jump destination, in Addr
+)
+
+// Operand is one operand of a decoded instruction.
+type Operand struct {
+	Kind OperandKind
+	Reg  uint32
+	Imm  int64
+	Addr uint32
+}
+
+// Instruction is a decoded instruction word.
+type Instruction struct {
+	Word, PC uint32
+	Spec     *isa.Spec // nil when the word matches no instruction
+	Mnemonic string    // empty when Spec is nil
+	Format   Format
+	Fields   isa.Fields
+	// Operands in assembly order. Implicit operands are omitted: the $ra of
+	// jalr and a zero break code, as DecodeWord omits them.
+	Operands []Operand
+	Branch   bool   // a branch or jump with a static destination
+	Target   uint32 // destination when Branch
+	// General purpose registers read and written, as reported by Spec.Use.
+	Reads, Writes []uint32
+}
+
+// Known reports whether the word decoded to an instruction.
+func (in Instruction) Known() bool {
+	return in.Spec != nil
+}
+
+// String renders the instruction as DecodeWord does, with absolute targets.
+func (in Instruction) String() string {
+	if in.Spec == nil {
+		return unknown(in.Word)
+	}
+	return format(in, DefaultStyle, nil)
+}
+
+// Decode decodes the instruction word at pc.
+func Decode(word, pc uint32) Instruction {
+	f := isa.Split(word)
+	in := Instruction{Word: word, PC: pc, Fields: f, Format: FormatI}
+	switch f.Op {
+	case 0x00, 0x10, 0x1C:
+		in.Format = FormatR
+	case 0x02, 0x03:
+		in.Format = FormatJ
+	}
+	s := isa.Decode(word)
+	if s == nil {
+		return in
+	}
+	in.Spec, in.Mnemonic = s, s.Name
+	in.Target, in.Branch = branchTarget(s, word, pc)
+
+	r := func(n uint32) Operand { return Operand{Kind: OpReg, Reg: n} }
+	imm := func(v int64) Operand { return Operand{Kind: OpImm, Imm: v} }
+	simm := int64(signExtend16(f.Imm))
+	target := Operand{Kind: OpTarget, Addr: in.Target}
+
+	switch s.Syntax {
+	case isa.SynRdRsRt:
+		in.Operands = []Operand{r(f.Rd), r(f.Rs), r(f.Rt)}
+	case isa.SynRdRtRs:
+		in.Operands = []Operand{r(f.Rd), r(f.Rt), r(f.Rs)}
+	case isa.SynRdRtSa:
+		in.Operands = []Operand{r(f.Rd), r(f.Rt), imm(int64(f.Shamt))}
+	case isa.SynRdRs:
+		in.Operands = []Operand{r(f.Rd), r(f.Rs)}
+	case isa.SynRsRt:
+		in.Operands = []Operand{r(f.Rs), r(f.Rt)}
+	case isa.SynRs:
+		in.Operands = []Operand{r(f.Rs)}
+	case isa.SynRd:
+		in.Operands = []Operand{r(f.Rd)}
+	case isa.SynJalr:
+		in.Operands = []Operand{r(f.Rd), r(f.Rs)}
+		if f.Rd == 31 {
+			in.Operands = in.Operands[1:]
+		}
+	case isa.SynCode:
+		if code := (word >> 6) & 0xFFFFF; code != 0 {
+			in.Operands = []Operand{imm(int64(code))}
+		}
+	case isa.SynRtCop:
+		in.Operands = []Operand{r(f.Rt), {Kind: OpCopReg, Reg: f.Rd}}
+	case isa.SynRtRsImm:
+		in.Operands = []Operand{r(f.Rt), r(f.Rs), imm(simm)}
+		if s.Imm == isa.ImmUnsigned {
+			in.Operands[2] = Operand{Kind: OpUImm, Imm: int64(f.Imm)}
+		}
+	case isa.SynRtImm:
+		in.Operands = []Operand{r(f.Rt), {Kind: OpUImm, Imm: int64(f.Imm)}}
+	case isa.SynRsImm:
+		in.Operands = []Operand{r(f.Rs), imm(simm)}
+	case isa.SynMem:
+		in.Operands = []Operand{r(f.Rt), {Kind: OpMem, Reg: f.Rs, Imm: simm}}
+	case isa.SynRsRtBranch:
+		in.Operands = []Operand{r(f.Rs), r(f.Rt), target}
+	case isa.SynRsBranch:
+		in.Operands = []Operand{r(f.Rs), target}
+	case isa.SynJump:
+		in.Operands = []Operand{target}
+	}
+	in.Reads, in.Writes = s.Use(word)
+	return in
+}
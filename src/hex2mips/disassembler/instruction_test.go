@@ -0,0 +1,55 @@
+package disassembler
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	// word, mnemonic, format, operands, reads, writes and destination at PC 0x3000
+	cases := []struct {
+		word                uint32
+		name, format, ops   string
+		reads, writes, dest string
+	}{
+		{0x8fa8fffc, "lw", "I", "[{0 8} {4 29 -4}]", "[29]", "[8]", ""},
+		{0xad09000c, "sw", "I", "[{0 9} {4 8 12}]", "[8 9]", "[]", ""},
+		{0x3128ffff, "andi", "I", "[{0 8} {0 9} {3 65535}]", "[9]", "[8]", ""},
+		{0x01084020, "add", "R", "[{0 8} {0 8} {0 8}]", "[8]", "[8]", ""},
+		{0x0c000c00, "jal", "J", "[{5 12288}]", "[]", "[31]", "3000"},
+		{0x1109fffe, "beq", "I", "[{0 8} {0 9} {5 12284}]", "[8 9]", "[]", "2ffc"},
+		{0x0100f809, "jalr", "R", "[{0 8}]", "[8]", "[31]", ""},
+		{0x401a7000, "mfc0", "R", "[{0 26} {1 14}]", "[]", "[26]", ""},
+		{0x000001cd, "break", "R", "[{2 7}]", "[]", "[]", ""},
+		{0xfc000000, "", "I", "[]", "[]", "[]", ""},
+	}
+	show := func(ops []Operand) string {
+		var s []string
+		for _, op := range ops {
+			switch op.Kind {
+			case OpReg, OpCopReg:
+				s = append(s, fmt.Sprintf("{%d %d}", op.Kind, op.Reg))
+			case OpMem:
+				s = append(s, fmt.Sprintf("{%d %d %d}", op.Kind, op.Reg, op.Imm))
+			case OpTarget:
+				s = append(s, fmt.Sprintf("{%d %d}", op.Kind, op.Addr))
+			default:
+				s = append(s, fmt.Sprintf("{%d %d}", op.Kind, op.Imm))
+			}
+		}
+		return "[" + strings.Join(s, " ") + "]"
+	}
+	for _, c := range cases {
+		in := Decode(c.word, 0x3000)
+		dest := ""
+		if in.Branch {
+			dest = fmt.Sprintf("%x", in.Target)
+		}
+		got := fmt.Sprintf("%s %s %s %v %v %s", in.Mnemonic, in.Format, show(in.Operands), fmt.Sprint(in.Reads), fmt.Sprint(in.Writes), dest)
+		want := fmt.Sprintf("%s %s %s %s %s %s", c.name, c.format, c.ops, c.reads, c.writes, c.dest)
+		if got != want {
+			t.Errorf("%08x decodes to %s, want %s", c.word, got, want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package disassembler
+
+import (
+	"fmt"
+	"strings"
+
+	"isa"
+)
+
+// Label returns the synthesized name of the label at addr.
+func Label(addr uint32) string {
+	return fmt.Sprintf("L_%x", addr)
+}
+
+// Program disassembles a whole .text image loaded at base into source that
+// mips2hex assembles back into the same words when given the same base.
+//
+// Every branch or jump destination inside the image gets a label (Label) and
+// is referenced by name. Destinations outside the image are written as a
+// numeric word offset (branches) or absolute address (jumps), which the
+// assembler encodes unchanged. Words that decode to no instruction, or whose
+// unused fields are not zero so that the assembler would not reproduce them,
+// are emitted as .word with the plain disassembly in a comment.
+func Program(words []uint32, base uint32) string {
+	end := base + uint32(len(words))*4
+	inside := func(addr uint32) bool {
+		return addr >= base && addr < end && addr&3 == 0
+	}
+
+	insts := make([]Instruction, len(words))
+	labels := map[uint32]string{}
+	for i, w := range words {
+		insts[i] = Decode(w, base+uint32(i)*4)
+		if in := insts[i]; in.Known() && in.Spec.Canonical(w) && in.Branch && inside(in.Target) {
+			labels[in.Target] = Label(in.Target)
+		}
+	}
+
+	target := func(s *isa.Spec, word, pc, dest uint32) string {
+		if name, ok := labels[dest]; ok {
+			return name
+		}
+		if s.Syntax == isa.SynJump {
+			return fmt.Sprintf("0x%08x", dest)
+		}
+		return fmt.Sprint(signExtend16(word & 0xFFFF))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %d words at 0x%08x, assemble with the same .text base\n", len(words), base)
+	b.WriteString(".text\n")
+	for i, w := range words {
+		pc := base + uint32(i)*4
+		if name, ok := labels[pc]; ok {
+			b.WriteString(name + ":\n")
+		}
+		if in := insts[i]; in.Known() && in.Spec.Canonical(w) {
+			b.WriteString("\t" + format(in, DefaultStyle, target) + "\n")
+			continue
+		}
+		fmt.Fprintf(&b, "\t.word 0x%08x\t# %s\n", w, insts[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,84 @@
+package disassembler
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"isa"
+	"mips2hex/assembler"
+)
+
+// TestProgram checks that the -asm output assembles back to the same words.
+func TestProgram(t *testing.T) {
+	const base = 0x3000
+	roundTrip := func(name string, words []uint32) {
+		t.Helper()
+		src := Program(words, base)
+		layout := assembler.Layout{TextBase: base, DataBase: 0}
+		// Out-of-range offsets in the original image are only warnings and do
+		// not change the encoding
+		prog, diags := assembler.AssembleSource(src, assembler.Options{File: name, Layout: layout, Mode: assembler.CheckWarn})
+		if diags.HasErrors() {
+			t.Fatalf("%s does not assemble: %v\n%s", name, diags, src)
+		}
+		if len(prog.Text) != len(words) {
+			t.Fatalf("%s assembles to %d words, want %d", name, len(prog.Text), len(words))
+		}
+		for i := range words {
+			if prog.Text[i] != words[i] {
+				t.Fatalf("%s word %d assembles to %08x, want %08x\n%s", name, i, prog.Text[i], words[i], src)
+			}
+		}
+	}
+
+	for i := 1; i <= 10; i++ {
+		data, err := os.ReadFile(filepath.Join("..", "..", "mips2hex", "test", fmt.Sprintf("instr%d.txt", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var words []uint32
+		for _, tok := range strings.Fields(string(data)) {
+			var w uint32
+			fmt.Sscanf(tok, "%x", &w)
+			words = append(words, w)
+		}
+		roundTrip(fmt.Sprintf("instr%d.txt", i), words)
+	}
+
+	// Every instruction with random operands, plus random words (mostly unknown
+	// or with nonzero reserved bits, written as .word). Branch and jump
+	// destinations fall both inside and outside the image.
+	rng := rand.New(rand.NewSource(1))
+	var words []uint32
+	for _, spec := range isa.Instructions {
+		for k := 0; k < 8; k++ {
+			words = append(words, spec.Match|rng.Uint32()&spec.Syntax.Operands())
+			words = append(words, rng.Uint32())
+		}
+	}
+	for i, w := range words {
+		// Point some branches into the image
+		if s := isa.Decode(w); s != nil && s.Syntax == isa.SynRsRtBranch && i%2 == 0 {
+			words[i] = w&^0xffff | uint32(-i/2)&0xffff
+		}
+	}
+	roundTrip("random", words)
+
+	src := Program([]uint32{0x11090001, 0x00000000, 0x08000c00, 0x012a4060, 0xffffffff}, base)
+	want := "# 5 words at 0x00003000, assemble with the same .text base\n" +
+		".text\n" +
+		"L_3000:\n" +
+		"\tbeq $t0, $t1, L_3008\n" +
+		"\tnop\n" +
+		"L_3008:\n" +
+		"\tj L_3000\n" +
+		"\t.word 0x012a4060\t# add $t0, $t1, $t2\n" +
+		"\t.word 0xffffffff\t# Itype_unknown_op_0x3f\n"
+	if src != want {
+		t.Errorf("got:\n%s\nwant:\n%s", src, want)
+	}
+}
@@ -0,0 +1,136 @@
+package disassembler
+
+import (
+	"fmt"
+	"strings"
+
+	"isa"
+)
+
+// RegStyle selects how general purpose registers are written.
+type RegStyle int
+
+const (
+	RegABI     RegStyle = iota // $t0
+	RegNumeric                 // $8
+	RegBare                    // t0, as objdump prints them
+)
+
+// ImmStyle selects how immediates, offsets, shift amounts and codes are written.
+type ImmStyle int
+
+const (
+	ImmAuto    ImmStyle = iota // signed values in decimal, andi/ori/xori/lui immediates as 0x%04x
+	ImmDecimal                 // everything in decimal
+	ImmHex                     // everything in hex, negative values as -0x8
+	ImmWord                    // everything as the sign-extended 32-bit word in hex, as MARS does
+)
+
+// TargetStyle selects how branch destinations are written. Jumps always show
+// the absolute address, since that is what their field encodes.
+type TargetStyle int
+
+const (
+	TargetAbsolute TargetStyle = iota // 0x00003010
+	TargetRelative                    // signed word offset from pc+4, as encoded
+)
+
+// Style controls how DecodeWord-style text is rendered.
+type Style struct {
+	Regs    RegStyle
+	Imm     ImmStyle
+	Targets TargetStyle
+	OpSep   string // between the mnemonic and the operands
+	Sep     string // between operands
+	Fields  bool   // append the raw fields, e.g. "# op=0x23 rs=29 rt=8 imm=0xfffc"
+}
+
+// Predefined styles.
+var (
+	// DefaultStyle is the style of DecodeWord.
+	DefaultStyle = Style{OpSep: " ", Sep: ", "}
+	// MARSStyle follows the Basic column of the MARS text segment:
+	// addiu $29,$29,0xfffffff8 and beq $8,$9,0x00000003.
+	MARSStyle = Style{Regs: RegNumeric, Imm: ImmWord, Targets: TargetRelative, OpSep: " ", Sep: ","}
+	// ObjdumpStyle follows GNU objdump: addiu	sp,sp,-8.
+	ObjdumpStyle = Style{Regs: RegBare, OpSep: "\t", Sep: ","}
+)
+
+// Styles maps the names accepted by ParseStyle to the predefined styles.
+var Styles = map[string]Style{"default": DefaultStyle, "mars": MARSStyle, "objdump": ObjdumpStyle}
+
+// ParseStyle returns the predefined style with the given name.
+func ParseStyle(name string) (Style, error) {
+	if s, ok := Styles[name]; ok {
+		return s, nil
+	}
+	return Style{}, fmt.Errorf("unknown style %q, expected default, mars or objdump", name)
+}
+
+// Render renders the instruction in style st.
+func (in Instruction) Render(st Style) string {
+	var s string
+	if in.Spec == nil {
+		s = unknown(in.Word)
+	} else {
+		s = format(in, st, nil)
+	}
+	if st.Fields {
+		s += "\t# " + fields(in)
+	}
+	return s
+}
+
+func (st Style) reg(n uint32) string {
+	switch st.Regs {
+	case RegNumeric:
+		return fmt.Sprintf("$%d", n)
+	case RegBare:
+		return strings.TrimPrefix(isa.RegName(n), "$")
+	}
+	return isa.RegName(n)
+}
+
+// imm renders a signed value.
+func (st Style) imm(v int64) string {
+	switch {
+	case st.Imm == ImmWord:
+		return fmt.Sprintf("0x%08x", uint32(v))
+	case st.Imm != ImmHex:
+		return fmt.Sprint(v)
+	case v < 0:
+		return fmt.Sprintf("-0x%x", -v)
+	}
+	return fmt.Sprintf("0x%x", v)
+}
+
+// uimm renders a zero-extended 16-bit immediate.
+func (st Style) uimm(v int64) string {
+	switch st.Imm {
+	case ImmDecimal:
+		return fmt.Sprint(v)
+	case ImmHex, ImmWord:
+		return st.imm(v)
+	}
+	return fmt.Sprintf("0x%04x", v)
+}
+
+// target renders a branch or jump destination at pc.
+func (st Style) target(s *isa.Spec, word, pc, dest uint32) string {
+	if st.Targets == TargetRelative && s.Syntax != isa.SynJump {
+		return st.imm(int64(signExtend16(word & 0xFFFF)))
+	}
+	return fmt.Sprintf("0x%08x", dest)
+}
+
+// fields describes the raw fields of the word in its encoding format.
+func fields(in Instruction) string {
+	f := in.Fields
+	switch in.Format {
+	case FormatR:
+		return fmt.Sprintf("op=0x%02x rs=%d rt=%d rd=%d shamt=%d funct=0x%02x", f.Op, f.Rs, f.Rt, f.Rd, f.Shamt, f.Funct)
+	case FormatJ:
+		return fmt.Sprintf("op=0x%02x target=0x%07x", f.Op, f.Target)
+	}
+	return fmt.Sprintf("op=0x%02x rs=%d rt=%d imm=0x%04x", f.Op, f.Rs, f.Rt, f.Imm)
+}
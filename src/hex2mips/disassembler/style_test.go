@@ -0,0 +1,44 @@
+package disassembler
+
+import "testing"
+
+func TestStyles(t *testing.T) {
+	words := []uint32{0x27bdfff8, 0x8fa8fffc, 0x1109fffe, 0x3128ffff, 0x0c000c00, 0x401a7000}
+	numeric := DefaultStyle
+	numeric.Regs, numeric.Imm, numeric.Targets, numeric.Fields = RegNumeric, ImmDecimal, TargetRelative, true
+	cases := []struct {
+		style Style
+		want  []string
+	}{
+		{DefaultStyle, []string{
+			"addiu $sp, $sp, -8", "lw $t0, -4($sp)", "beq $t0, $t1, 0x00003004",
+			"andi $t0, $t1, 0xffff", "jal 0x00003000", "mfc0 $k0, $14",
+		}},
+		{MARSStyle, []string{
+			"addiu $29,$29,0xfffffff8", "lw $8,0xfffffffc($29)", "beq $8,$9,0xfffffffe",
+			"andi $8,$9,0x0000ffff", "jal 0x00003000", "mfc0 $26,$14",
+		}},
+		{ObjdumpStyle, []string{
+			"addiu\tsp,sp,-8", "lw\tt0,-4(sp)", "beq\tt0,t1,0x00003004",
+			"andi\tt0,t1,0xffff", "jal\t0x00003000", "mfc0\tk0,$14",
+		}},
+		{numeric, []string{
+			"addiu $29, $29, -8\t# op=0x09 rs=29 rt=29 imm=0xfff8",
+			"lw $8, -4($29)\t# op=0x23 rs=29 rt=8 imm=0xfffc",
+			"beq $8, $9, -2\t# op=0x04 rs=8 rt=9 imm=0xfffe",
+			"andi $8, $9, 65535\t# op=0x0c rs=9 rt=8 imm=0xffff",
+			"jal 0x00003000\t# op=0x03 target=0x0000c00",
+			"mfc0 $26, $14\t# op=0x10 rs=0 rt=26 rd=14 shamt=0 funct=0x00",
+		}},
+	}
+	for i, c := range cases {
+		for j, w := range words {
+			if got := Decode(w, 0x3000+uint32(j)*4).Render(c.style); got != c.want[j] {
+				t.Errorf("style %d: %08x renders as %q, want %q", i, w, got, c.want[j])
+			}
+		}
+	}
+	if _, err := ParseStyle("gas"); err == nil {
+		t.Errorf("unknown style accepted")
+	}
+}
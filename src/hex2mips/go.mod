@@ -1,3 +1,15 @@
 module hex2mips
 
 go 1.24.0
+
+require (
+	isa v0.0.0
+	memcfg v0.0.0
+	mips2hex v0.0.0
+)
+
+replace (
+	isa => ../isa
+	memcfg => ../memcfg
+	mips2hex => ../mips2hex
+)
@@ -0,0 +1,337 @@
+// Package image reads program memory images in the formats produced by the
+// course toolchain and by common tools: the ROM contents of a Logisim .circ,
+// Logisim "v2.0 raw" images, Verilog $readmemh files, Intel HEX, raw binary
+// and ELF executables.
+package image
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Formats lists the names accepted by Parse, in the order Detect tries them.
+var Formats = []string{"elf", "circ", "logisim", "ihex", "readmemh", "bin", "words"}
+
+// MaxWords bounds the images whose size is not bounded by the file itself:
+// Logisim run lengths, $readmemh addresses and Intel HEX addresses could
+// otherwise ask for gigabytes. It is the size of the 12-bit addressed IM ROM.
+const MaxWords = 1 << 12
+
+// Image is a run of instruction words.
+type Image struct {
+	Words []uint32
+	// Base is the address of the first word, known only when HasBase is set
+	// ($readmemh with @ records, Intel HEX and ELF carry addresses; ROM images
+	// start at the ROM's own 0).
+	Base    uint32
+	HasBase bool
+	// More holds the further runs of an Intel HEX file whose records leave
+	// gaps, in address order, each with its own Base.
+	More []*Image
+}
+
+// Detect guesses the format of a file from its name and contents. "words" is
+// the plain one-word-per-token text hex2mips has always read.
+func Detect(path string, data []byte) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case bytes.HasPrefix(data, []byte(elf.ELFMAG)):
+		return "elf"
+	case ext == ".circ":
+		return "circ"
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte("v2.0 raw")):
+		return "logisim"
+	case bytes.HasPrefix(bytes.TrimSpace(data), []byte(":")):
+		return "ihex"
+	case readmemAddrRe.Match(data):
+		return "readmemh"
+	case ext == ".bin":
+		return "bin"
+	}
+	return "words"
+}
+
+// Parse reads data in the given format. order is the byte order of words in
+// Intel HEX and raw binary files; ELF files carry their own. Trailing zero
+// words, the unused rest of a ROM, are dropped from ROM images. The "words"
+// format is not handled here.
+func Parse(format string, data []byte, order binary.ByteOrder) (*Image, error) {
+	switch format {
+	case "circ":
+		return parseCirc(data)
+	case "logisim":
+		return parseLogisim(data)
+	case "readmemh":
+		return parseReadmemh(data)
+	case "ihex":
+		return parseIntelHex(data, order)
+	case "bin":
+		return parseBinary(data, order)
+	case "elf":
+		return parseELF(data)
+	}
+	return nil, fmt.Errorf("unknown image format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// trim drops trailing zero words.
+func trim(words []uint32) []uint32 {
+	for len(words) > 0 && words[len(words)-1] == 0 {
+		words = words[:len(words)-1]
+	}
+	return words
+}
+
+// circRe matches the ROM contents that logisim.injectHexIntoCirc writes:
+// 12-bit addresses and 32-bit data.
+var circRe = regexp.MustCompile(`addr/data: 12 32([\s\S]*?)</a>`)
+
+func parseCirc(data []byte) (*Image, error) {
+	m := circRe.FindSubmatch(data)
+	if m == nil {
+		return nil, fmt.Errorf("no ROM with \"addr/data: 12 32\" contents in the circuit")
+	}
+	words, err := logisimWords(string(m[1]))
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Words: trim(words)}, nil
+}
+
+func parseLogisim(data []byte) (*Image, error) {
+	body := strings.TrimPrefix(strings.TrimSpace(string(data)), "v2.0 raw")
+	words, err := logisimWords(body)
+	if err != nil {
+		return nil, err
+	}
+	return &Image{Words: trim(words)}, nil
+}
+
+// logisimWords parses Logisim memory contents: hex values separated by
+// whitespace, N*value for N repeated values, and # comments.
+func logisimWords(s string) ([]uint32, error) {
+	var words []uint32
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line, _, _ := strings.Cut(sc.Text(), "#")
+		for _, tok := range strings.Fields(line) {
+			count, value := uint64(1), tok
+			if n, v, ok := strings.Cut(tok, "*"); ok {
+				c, err := strconv.ParseUint(n, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("bad run length in %q", tok)
+				}
+				count, value = c, v
+			}
+			w, err := strconv.ParseUint(value, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad value %q", tok)
+			}
+			if uint64(len(words))+count > MaxWords {
+				return nil, fmt.Errorf("%q makes the image longer than %d words", tok, MaxWords)
+			}
+			for ; count > 0; count-- {
+				words = append(words, uint32(w))
+			}
+		}
+	}
+	return words, sc.Err()
+}
+
+var (
+	readmemAddrRe    = regexp.MustCompile(`(?m)^\s*@[0-9a-fA-F]+`)
+	readmemCommentRe = regexp.MustCompile(`//.*|/\*[\s\S]*?\*/`)
+)
+
+// parseReadmemh parses $readmemh input: hex words (underscores allowed) and
+// @addr, the word address of the next value. The image starts at the lowest
+// address written; skipped words read as zero.
+func parseReadmemh(data []byte) (*Image, error) {
+	mem := map[uint64]uint32{}
+	next, lo, hi := uint64(0), uint64(0), uint64(0)
+	hasBase := false
+	for _, tok := range strings.Fields(readmemCommentRe.ReplaceAllString(string(data), " ")) {
+		if addr, ok := strings.CutPrefix(tok, "@"); ok {
+			a, err := strconv.ParseUint(addr, 16, 32)
+			if err != nil {
+				return nil, fmt.Errorf("bad address %q", tok)
+			}
+			next, hasBase = a, true
+			continue
+		}
+		w, err := strconv.ParseUint(strings.ReplaceAll(tok, "_", ""), 16, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad value %q", tok)
+		}
+		if next >= 1<<30 {
+			return nil, fmt.Errorf("value %q lies beyond the 32-bit address space", tok)
+		}
+		if len(mem) == 0 {
+			lo, hi = next, next
+		}
+		lo, hi = min(lo, next), max(hi, next)
+		if hi-lo >= MaxWords {
+			return nil, fmt.Errorf("addresses %x to %x span more than %d words", lo, hi, MaxWords)
+		}
+		mem[next] = uint32(w)
+		next++
+	}
+	if len(mem) == 0 {
+		return &Image{}, nil
+	}
+	words := make([]uint32, hi-lo+1)
+	for a, w := range mem {
+		words[a-lo] = w
+	}
+	return &Image{Words: trim(words), Base: uint32(lo * 4), HasBase: hasBase}, nil
+}
+
+// parseIntelHex parses Intel HEX data records with extended segment (02) and
+// extended linear (04) addresses. Each contiguous run of words written becomes
+// a run of the image, the lowest first; bytes missing within a word read as
+// zero.
+func parseIntelHex(data []byte, order binary.ByteOrder) (*Image, error) {
+	mem := map[uint64]byte{}
+	var upper uint64
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		rec, err := hex.DecodeString(strings.TrimPrefix(line, ":"))
+		if !strings.HasPrefix(line, ":") || err != nil || len(rec) < 5 || len(rec) != int(rec[0])+5 {
+			return nil, fmt.Errorf("line %d: malformed record", n)
+		}
+		var sum byte
+		for _, b := range rec {
+			sum += b
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: checksum mismatch", n)
+		}
+		payload := rec[4 : len(rec)-1]
+		if (rec[3] == 0x02 || rec[3] == 0x04) && len(payload) != 2 {
+			return nil, fmt.Errorf("line %d: malformed address record", n)
+		}
+		switch rec[3] {
+		case 0x00:
+			addr := upper + (uint64(rec[1])<<8 | uint64(rec[2]))
+			if addr+uint64(len(payload)) > 1<<32 {
+				return nil, fmt.Errorf("line %d: record runs past the 32-bit address space", n)
+			}
+			for i, b := range payload {
+				mem[addr+uint64(i)] = b
+			}
+		case 0x01:
+			return bytesImage(mem, order)
+		case 0x02:
+			upper = uint64(payload[0])<<12 | uint64(payload[1])<<4
+		case 0x04:
+			upper = uint64(payload[0])<<24 | uint64(payload[1])<<16
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return bytesImage(mem, order)
+}
+
+// bytesImage packs bytes at absolute addresses into words, one run for each
+// contiguous stretch of words.
+func bytesImage(mem map[uint64]byte, order binary.ByteOrder) (*Image, error) {
+	if len(mem) == 0 {
+		return &Image{}, nil
+	}
+	addrs := make([]uint64, 0, len(mem))
+	for a := range mem {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i] < addrs[j] })
+	var runs []*Image
+	var buf []byte
+	base := addrs[0] &^ 3
+	flush := func() error {
+		img, err := parseBinary(buf, order)
+		if err != nil {
+			return err
+		}
+		img.Base, img.HasBase = uint32(base), true
+		runs = append(runs, img)
+		return nil
+	}
+	total := 0
+	for _, a := range addrs {
+		if a >= base+uint64(len(buf))+4 {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			buf, base = nil, a&^3
+		}
+		for uint64(len(buf)) <= a-base {
+			buf = append(buf, 0, 0, 0, 0)
+			if total++; total > MaxWords {
+				return nil, fmt.Errorf("image is longer than %d words", MaxWords)
+			}
+		}
+		buf[a-base] = mem[a]
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	runs[0].More = runs[1:]
+	return runs[0], nil
+}
+
+func parseBinary(data []byte, order binary.ByteOrder) (*Image, error) {
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("binary image of %d bytes is not a whole number of words", len(data))
+	}
+	words := make([]uint32, len(data)/4)
+	for i := range words {
+		words[i] = order.Uint32(data[i*4:])
+	}
+	return &Image{Words: words}, nil
+}
+
+// parseELF reads the .text section of a MIPS ELF file, or its first
+// executable section when there is no .text.
+func parseELF(data []byte) (*Image, error) {
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if f.Machine != elf.EM_MIPS {
+		return nil, fmt.Errorf("ELF machine is %v, not MIPS", f.Machine)
+	}
+	sec := f.Section(".text")
+	if sec == nil {
+		for _, s := range f.Sections {
+			if s.Type == elf.SHT_PROGBITS && s.Flags&elf.SHF_EXECINSTR != 0 {
+				sec = s
+				break
+			}
+		}
+	}
+	if sec == nil {
+		return nil, fmt.Errorf("ELF file has no executable section")
+	}
+	body, err := sec.Data()
+	if err != nil {
+		return nil, err
+	}
+	img, err := parseBinary(body, f.ByteOrder)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", sec.Name, err)
+	}
+	img.Base, img.HasBase = uint32(sec.Addr), true
+	return img, nil
+}
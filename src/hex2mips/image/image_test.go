@@ -0,0 +1,213 @@
+package image
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mips2hex/emitter"
+)
+
+func TestParse(t *testing.T) {
+	want := "[3c011001 34280004 00000000 8d090000]"
+	cases := []struct {
+		name, format, data string
+		base               uint32 // 0 when the file carries no address
+	}{
+		{"cpu.circ", "circ", `<comp lib="4" loc="(100,100)" name="ROM">
+      <a name="addrWidth" val="12"/>
+      <a name="contents">addr/data: 12 32
+3c011001 34280004 0 8d090000 1020*0
+</a>
+    </comp>`, 0},
+		{"im.txt", "logisim", "v2.0 raw\n3c011001 34280004\n1*0 # comment\n8d090000 4*0\n", 0},
+		{"im.hex", "readmemh", "// code\n@c01 34280004\n@c00 3c011001\n@c03 8d09_0000\n@c10 00000000\n", 0x3000},
+		{"im.ihex", "ihex", ":020000040000FA\n:08300000342800040000000068\n:043008008D0900002E\n:042FFC003C01100183\n:00000001FF\n", 0x2ffc},
+	}
+	for _, c := range cases {
+		data := []byte(c.data)
+		if got := Detect(c.name, data); got != c.format {
+			t.Errorf("%s detected as %s, want %s", c.name, got, c.format)
+		}
+		img, err := Parse(c.format, data, binary.BigEndian)
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if got := fmt.Sprintf("%08x", img.Words); got != want {
+			t.Errorf("%s reads as %s, want %s", c.name, got, want)
+		}
+		if img.HasBase != (c.base != 0) || img.Base != c.base {
+			t.Errorf("%s base is %x (%v), want %x", c.name, img.Base, img.HasBase, c.base)
+		}
+	}
+
+	bin := []byte{0x01, 0x10, 0x01, 0x3c, 0x04, 0x00, 0x28, 0x34}
+	if got := Detect("im.bin", bin); got != "bin" {
+		t.Errorf("im.bin detected as %s", got)
+	}
+	img, err := Parse("bin", bin, binary.LittleEndian)
+	if err != nil || fmt.Sprintf("%08x", img.Words) != "[3c011001 34280004]" {
+		t.Errorf("little-endian binary reads as %v %v", img, err)
+	}
+	if _, err := Parse("bin", bin[:6], binary.BigEndian); err == nil {
+		t.Errorf("binary of a partial word accepted")
+	}
+	if _, err := Parse("ihex", []byte(":0400000034280004FF\n"), binary.BigEndian); err == nil {
+		t.Errorf("Intel HEX with a bad checksum accepted")
+	}
+	if got := Detect("out.txt", []byte("3c011001\n34280004\n")); got != "words" {
+		t.Errorf("hex words detected as %s", got)
+	}
+}
+
+// ihex builds an Intel HEX record with its checksum.
+func ihex(typ byte, addr uint16, data ...byte) string {
+	rec := append([]byte{byte(len(data)), byte(addr >> 8), byte(addr), typ}, data...)
+	var sum byte
+	for _, b := range rec {
+		sum -= b
+	}
+	return fmt.Sprintf(":%X%02X\n", rec, sum)
+}
+
+func TestParseEmitted(t *testing.T) {
+	words := []uint32{0x3c011001, 0x34280004, 0x8d090000}
+	for _, format := range []string{"readmemh", "ihex"} {
+		f, ok := emitter.Lookup(format)
+		if !ok {
+			t.Fatalf("no %s emitter", format)
+		}
+		var b bytes.Buffer
+		if err := f.Write(&b, 0x00400000, words); err != nil {
+			t.Fatal(err)
+		}
+		if got := Detect("out", b.Bytes()); got != format {
+			t.Errorf("%s output detected as %s", format, got)
+		}
+		img, err := Parse(format, b.Bytes(), binary.BigEndian)
+		if err != nil {
+			t.Errorf("%s: %v", format, err)
+			continue
+		}
+		if fmt.Sprint(img.Words) != fmt.Sprint(words) || img.Base != 0x00400000 || !img.HasBase || len(img.More) != 0 {
+			t.Errorf("%s output reads as %08x at %x (%v)", format, img.Words, img.Base, img.HasBase)
+		}
+	}
+}
+
+func TestParseRuns(t *testing.T) {
+	// Records far apart become separate runs instead of one zero-filled image
+	data := ihex(4, 0, 0x00, 0x40) + ihex(0, 0, 0x3c, 0x01, 0x10, 0x01, 0x34) +
+		ihex(4, 0, 0x10, 0x01) + ihex(0, 0x10, 0x8d, 0x09, 0x00, 0x00) + ihex(1, 0)
+	img, err := Parse("ihex", []byte(data), binary.BigEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range append([]*Image{img}, img.More...) {
+		got = append(got, fmt.Sprintf("%x:%08x", r.Base, r.Words))
+	}
+	if want := "400000:[3c011001 34000000] 10010010:[8d090000]"; strings.Join(got, " ") != want {
+		t.Errorf("runs are %s, want %s", strings.Join(got, " "), want)
+	}
+
+	// The last byte of the address space
+	img, err = Parse("ihex", []byte(ihex(4, 0, 0xff, 0xff)+ihex(0, 0xffff, 0x2a)), binary.BigEndian)
+	if err != nil || img.Base != 0xfffffffc || fmt.Sprint(img.Words) != "[42]" {
+		t.Errorf("byte at ffffffff reads as %+v, %v", img, err)
+	}
+	if _, err := Parse("ihex", []byte(ihex(4, 0, 0xff, 0xff)+ihex(0, 0xffff, 1, 2)), binary.BigEndian); err == nil {
+		t.Errorf("record past ffffffff accepted")
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	long := make([]byte, 0, (MaxWords+4)*4)
+	for i := 0; i < MaxWords+4; i++ {
+		long = append(long, 0, 0, 0, byte(i))
+	}
+	var big strings.Builder
+	for i := 0; i < len(long); i += 16 {
+		big.WriteString(ihex(0, uint16(i), long[i:i+16]...))
+	}
+	cases := []struct{ name, format, data string }{
+		{"run length", "logisim", "v2.0 raw\n4294967295*0\n"},
+		{"run past the ROM", "logisim", "v2.0 raw\n1 4096*0\n"},
+		{"far address", "readmemh", "@0 1\n@ffffff0 2\n"},
+		{"address past 32 bits", "readmemh", "@ffffffff 1 2\n"},
+		{"long Intel HEX", "ihex", big.String()},
+	}
+	for _, c := range cases {
+		if img, err := Parse(c.format, []byte(c.data), binary.BigEndian); err == nil {
+			t.Errorf("%s: read %d words without error", c.name, len(img.Words))
+		}
+	}
+	if _, err := Parse("logisim", []byte("v2.0 raw\n1 4095*0\n"), binary.BigEndian); err != nil {
+		t.Errorf("full ROM rejected: %v", err)
+	}
+}
+
+// elfFile builds a minimal ELF32 executable whose only section, .text at addr,
+// holds words in the given byte order.
+func elfFile(order binary.ByteOrder, machine elf.Machine, addr uint32, words []uint32) []byte {
+	const shstrtab = "\x00.text\x00.shstrtab\x00"
+	text := make([]byte, len(words)*4)
+	for i, w := range words {
+		order.PutUint32(text[i*4:], w)
+	}
+	data := elf.ELFDATA2LSB
+	if order == binary.BigEndian {
+		data = elf.ELFDATA2MSB
+	}
+	textOff := uint32(binary.Size(elf.Header32{}))
+	strOff := textOff + uint32(len(text))
+	shOff := (strOff + uint32(len(shstrtab)) + 3) &^ 3
+	hdr := elf.Header32{
+		Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT),
+		Entry: addr, Shoff: shOff, Ehsize: uint16(textOff),
+		Shentsize: uint16(binary.Size(elf.Section32{})), Shnum: 3, Shstrndx: 2,
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS32)
+	hdr.Ident[elf.EI_DATA] = byte(data)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	sections := []elf.Section32{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_PROGBITS), Flags: uint32(elf.SHF_ALLOC | elf.SHF_EXECINSTR),
+			Addr: addr, Off: textOff, Size: uint32(len(text)), Addralign: 4},
+		{Name: 7, Type: uint32(elf.SHT_STRTAB), Off: strOff, Size: uint32(len(shstrtab)), Addralign: 1},
+	}
+	var b bytes.Buffer
+	binary.Write(&b, order, hdr)
+	b.Write(text)
+	b.WriteString(shstrtab)
+	b.Write(make([]byte, int(shOff)-b.Len()))
+	binary.Write(&b, order, sections)
+	return b.Bytes()
+}
+
+func TestParseELF(t *testing.T) {
+	words := []uint32{0x3c011001, 0x34280004, 0x8d090000}
+	for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+		data := elfFile(order, elf.EM_MIPS, 0x00400000, words)
+		if got := Detect("a.out", data); got != "elf" {
+			t.Errorf("%v ELF detected as %s", order, got)
+		}
+		// The ELF header's byte order wins over the one passed in
+		img, err := Parse("elf", data, binary.LittleEndian)
+		if err != nil {
+			t.Errorf("%v ELF: %v", order, err)
+			continue
+		}
+		if fmt.Sprint(img.Words) != fmt.Sprint(words) || img.Base != 0x00400000 || !img.HasBase {
+			t.Errorf("%v ELF reads as %08x at %x (%v)", order, img.Words, img.Base, img.HasBase)
+		}
+	}
+	if _, err := Parse("elf", elfFile(binary.LittleEndian, elf.EM_386, 0x08048000, words), binary.BigEndian); err == nil || !strings.Contains(err.Error(), "not MIPS") {
+		t.Errorf("x86 ELF gives %v, want a machine error", err)
+	}
+}
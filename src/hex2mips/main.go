@@ -2,9 +2,14 @@ package main
 
 import (
 	"bufio"
+	"encoding/binary"
 	"flag"
 	"fmt"
+	"hex2mips/cfg"
 	"hex2mips/disassembler"
+	"hex2mips/image"
+	"memcfg"
+	"mips2hex/assembler"
 	"os"
 	"strconv"
 	"strings"
@@ -59,12 +64,23 @@ func parseWord(token string) (uint32, error) {
 
 func main() {
 	// Define flags
-	baseAddr := flag.String("base", "0x00400000", "Base address for PC (in hex)")
+	memName := flag.String("mem", "default", "Memory configuration whose .text base is the default PC. "+memcfg.Usage())
+	baseAddr := flag.String("base", "", "Base address for PC (in hex), overrides -mem")
 	nonInteractive := flag.Bool("n", false, "Non-interactive mode, no prompts")
 	inputHex := flag.String("input_hex", "", "Hex string to disassemble")
 	inputHexShort := flag.String("ih", "", "Hex string to disassemble (shorthand)")
 	inputFile := flag.String("input", "", "Input file path")
 	inputFileShort := flag.String("i", "", "Input file path (shorthand)")
+	styleName := flag.String("style", "default", "Listing style: default ($t0, -8, absolute targets), mars (MARS Basic column: $8,0xfffffff8, relative branches) or objdump (addiu\tsp,sp,-8)")
+	regStyle := flag.String("regs", "", "Override the style's register names: abi ($t0), numeric ($8) or bare (t0)")
+	immStyle := flag.String("imm", "", "Override the style's immediates: auto, dec, hex or word (32-bit hex)")
+	targetStyle := flag.String("targets", "", "Override the style's branch targets: abs (address) or rel (word offset)")
+	showFields := flag.Bool("fields", false, "Append the raw fields of each word, e.g. op=0x23 rs=29 rt=8 imm=0xfffc")
+	formatName := flag.String("format", "", "Input format: "+strings.Join(image.Formats, ", ")+"; detected from the file when empty. words is one instruction per token, circ the IM ROM of a Logisim circuit")
+	endian := flag.String("endian", "big", "Byte order of words in ihex and bin input: big or little")
+	cfgOut := flag.String("cfg", "", "Print the control flow graph of the whole program instead of a listing: dot or json. A .s/.asm input is assembled first and its labels name the blocks")
+	pseudoOut := flag.Bool("pseudo", false, "Print common expansions as pseudo-instructions (li, la, move, b) instead of the exact instructions")
+	asmOut := flag.Bool("asm", false, "Print the whole program as source that mips2hex re-assembles to the same words (labels for branch/jump targets, .word for undecodable words)")
 
 	flag.Parse()
 
@@ -78,13 +94,40 @@ func main() {
 		filePath = *inputFileShort
 	}
 
-	// Parse base address
-	base, err := strconv.ParseUint(*baseAddr, 0, 32)
+	if *endian != "big" && *endian != "little" {
+		fmt.Fprintf(os.Stderr, "Unknown -endian '%s', expected big or little\n", *endian)
+		os.Exit(1)
+	}
+	if *cfgOut != "" && *cfgOut != "dot" && *cfgOut != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown -cfg format '%s', expected dot or json\n", *cfgOut)
+		os.Exit(1)
+	}
+	style, err := listingStyle(*styleName, *regStyle, *immStyle, *targetStyle, *showFields)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error parsing base address: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	pc := uint32(base)
+	// -asm, -cfg and -pseudo disassemble all input words as one program
+	out := output{cfg: *cfgOut, asm: *asmOut, pseudo: *pseudoOut, style: style}
+	whole := out.asm || out.cfg != "" || out.pseudo
+
+	// Parse base address, falling back to the memory configuration
+	var textBase *uint32
+	if *baseAddr != "" {
+		base, err := strconv.ParseUint(*baseAddr, 0, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing base address: %v\n", err)
+			os.Exit(1)
+		}
+		textBase = new(uint32)
+		*textBase = uint32(base)
+	}
+	mem, err := memcfg.Resolve(*memName, textBase, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	pc := mem.TextBase
 
 	// --- Input Handling Logic ---
 	// 1. --input_hex / -ih
@@ -94,7 +137,11 @@ func main() {
 			fmt.Fprintf(os.Stderr, "Error parsing hex input '%s': %v\n", hexStr, err)
 			os.Exit(1)
 		}
-		asm := disassembler.DecodeWord(word, pc)
+		if whole {
+			out.emit([]uint32{word}, pc, nil, nil)
+			return
+		}
+		asm := disassembler.Decode(word, pc).Render(style)
 		fmt.Printf("0x%08x: 0x%08x\t%s\n", pc, word, asm)
 		return
 	}
@@ -104,6 +151,63 @@ func main() {
 		filePath = flag.Arg(0)
 	}
 
+	if filePath != "" && assembler.IsSource(filePath) {
+		if !whole {
+			fmt.Fprintf(os.Stderr, "Assembly source %s can only be used with -cfg, -asm or -pseudo\n", filePath)
+			os.Exit(1)
+		}
+		words, text, data, err := assembleSource(filePath, assembler.Layout{TextBase: pc, DataBase: mem.DataBase})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		out.emit(words, pc, text, data)
+		return
+	}
+
+	if filePath != "" {
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file %s: %v\n", filePath, err)
+			os.Exit(1)
+		}
+		format := *formatName
+		if format == "" {
+			format = image.Detect(filePath, data)
+		}
+		if format != "words" {
+			var order binary.ByteOrder = binary.BigEndian
+			if *endian == "little" {
+				order = binary.LittleEndian
+			}
+			img, err := image.Parse(format, data, order)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s as %s: %v\n", filePath, format, err)
+				os.Exit(1)
+			}
+			// Addresses in the file win over -mem, an explicit -base over both
+			if img.HasBase && *baseAddr == "" {
+				pc = img.Base
+			}
+			if whole {
+				if len(img.More) > 0 {
+					fmt.Fprintf(os.Stderr, "%s holds %d separate runs of words; -cfg, -asm and -pseudo need one\n", filePath, len(img.More)+1)
+					os.Exit(1)
+				}
+				out.emit(img.Words, pc, nil, nil)
+				return
+			}
+			// Later runs keep their distance from the first
+			for _, run := range append([]*image.Image{img}, img.More...) {
+				for i, word := range run.Words {
+					at := pc + run.Base - img.Base + uint32(i)*4
+					fmt.Printf("0x%08x: 0x%08x\t%s\n", at, word, disassembler.Decode(word, at).Render(style))
+				}
+			}
+			return
+		}
+	}
+
 	var scanner *bufio.Scanner
 	if filePath != "" {
 		file, err := os.Open(filePath)
@@ -124,10 +228,12 @@ func main() {
 	}
 
 	// --- Processing Loop ---
+	base := pc
+	var words []uint32
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "//") {
-			if line != "" && !*nonInteractive {
+			if line != "" && !*nonInteractive && !whole {
 				fmt.Println(line)
 			}
 			continue
@@ -136,6 +242,10 @@ func main() {
 		tokens := strings.Fields(line)
 		for _, tok := range tokens {
 			word, err := parseWord(tok)
+			if err != nil && whole {
+				fmt.Fprintf(os.Stderr, "Error parsing token '%s' at 0x%08x: %v\n", tok, pc, err)
+				os.Exit(1)
+			}
 			if err != nil {
 				if !*nonInteractive {
 					fmt.Printf("0x%08x: ERROR parsing token '%s': %v\n", pc, tok, err)
@@ -143,7 +253,12 @@ func main() {
 				pc += 4
 				continue
 			}
-			asm := disassembler.DecodeWord(word, pc)
+			if whole {
+				words = append(words, word)
+				pc += 4
+				continue
+			}
+			asm := disassembler.Decode(word, pc).Render(style)
 			fmt.Printf("0x%08x: 0x%08x\t%s\n", pc, word, asm)
 			pc += 4
 		}
@@ -155,4 +270,85 @@ func main() {
 		}
 		os.Exit(1)
 	}
+	if whole {
+		out.emit(words, base, nil, nil)
+	}
+}
+
+// listingStyle returns the named style with the given overrides applied;
+// empty overrides keep the style's own choice.
+func listingStyle(name, regs, imm, targets string, fields bool) (disassembler.Style, error) {
+	st, err := disassembler.ParseStyle(name)
+	if err != nil {
+		return st, err
+	}
+	switch regs {
+	case "":
+	case "abi":
+		st.Regs = disassembler.RegABI
+	case "numeric":
+		st.Regs = disassembler.RegNumeric
+	case "bare":
+		st.Regs = disassembler.RegBare
+	default:
+		return st, fmt.Errorf("unknown -regs %q, expected abi, numeric or bare", regs)
+	}
+	switch imm {
+	case "":
+	case "auto":
+		st.Imm = disassembler.ImmAuto
+	case "dec":
+		st.Imm = disassembler.ImmDecimal
+	case "hex":
+		st.Imm = disassembler.ImmHex
+	case "word":
+		st.Imm = disassembler.ImmWord
+	default:
+		return st, fmt.Errorf("unknown -imm %q, expected auto, dec, hex or word", imm)
+	}
+	switch targets {
+	case "":
+	case "abs":
+		st.Targets = disassembler.TargetAbsolute
+	case "rel":
+		st.Targets = disassembler.TargetRelative
+	default:
+		return st, fmt.Errorf("unknown -targets %q, expected abs or rel", targets)
+	}
+	st.Fields = fields
+	return st, nil
+}
+
+// output selects what is printed for a whole program.
+type output struct {
+	cfg    string // control flow graph format, dot or json
+	asm    bool   // re-assemblable source
+	pseudo bool   // listing with pseudo-instructions
+	style  disassembler.Style
+}
+
+// emit prints words loaded at base as one program. text names .text addresses
+// for -cfg, data names .data addresses for la in -pseudo listings.
+func (o output) emit(words []uint32, base uint32, text, data map[uint32]string) {
+	var err error
+	switch {
+	case o.cfg == "dot":
+		err = cfg.Build(words, base, text).WriteDOT(os.Stdout)
+	case o.cfg == "json":
+		err = cfg.Build(words, base, text).WriteJSON(os.Stdout)
+	case o.asm:
+		fmt.Print(disassembler.Program(words, base))
+	default:
+		for _, l := range disassembler.Idioms(words, base, o.style, data) {
+			hex := make([]string, len(l.Words))
+			for i, w := range l.Words {
+				hex[i] = fmt.Sprintf("0x%08x", w)
+			}
+			fmt.Printf("0x%08x: %s\t%s\n", l.PC, strings.Join(hex, " "), l.Text)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(1)
+	}
 }
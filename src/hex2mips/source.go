@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"mips2hex/assembler"
+	"mips2hex/diag"
+	"mips2hex/types"
+)
+
+// assembleSource assembles path with the given layout and returns its .text
+// image together with the names of its .text and .data labels by address.
+func assembleSource(path string, layout assembler.Layout) (words []uint32, text, data map[uint32]string, err error) {
+	prog, diags := assembler.AssembleFile(path, assembler.Options{Layout: layout, Mode: assembler.CheckWarn})
+	diag.Print(os.Stderr, diags)
+	if diags.HasErrors() {
+		return nil, nil, nil, fmt.Errorf("assemble %s failed", path)
+	}
+	text, data = map[uint32]string{}, map[uint32]string{}
+	for _, sym := range prog.Symbols {
+		names := text
+		if sym.Seg != types.Text {
+			names = data
+		}
+		if _, taken := names[sym.Addr]; !taken {
+			names[sym.Addr] = sym.Name
+		}
+	}
+	return prog.Text, text, data, nil
+}
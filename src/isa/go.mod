@@ -0,0 +1,3 @@
+module isa
+
+go 1.24.0
@@ -0,0 +1,375 @@
+// Package isa 是汇编器、反汇编器与仿真器共用的指令集描述。
+// 每条指令由固定位（Match/Mask）、操作数写法与立即数类别声明一次：
+// 汇编器按 Syntax 解析操作数并把字段填入 Match，反汇编器与仿真器用 Decode 识别指令，
+// 仿真器再按 Name 找到执行语义。
+package isa
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+// Syntax 是指令的操作数写法，决定各寄存器与立即数放在哪个字段
+type Syntax int
+
+const (
+	SynNone       Syntax = iota // syscall、eret、nop
+	SynRdRsRt                   // add rd, rs, rt
+	SynRdRtRs                   // sllv rd, rt, rs
+	SynRdRtSa                   // sll rd, rt, sa
+	SynRdRs                     // clz rd, rs
+	SynRsRt                     // mult rs, rt
+	SynRs                       // jr rs
+	SynRd                       // mfhi rd
+	SynJalr                     // jalr [rd,] rs，省略 rd 时为 $ra
+	SynCode                     // break [code]，code 占 25..6 位
+	SynRtCop                    // mfc0 rt, rd，rd 为协处理器 0 的寄存器号
+	SynRtRsImm                  // addi rt, rs, imm
+	SynRtImm                    // lui rt, imm
+	SynRsImm                    // teqi rs, imm
+	SynMem                      // lw rt, offset(base)
+	SynRsRtBranch               // beq rs, rt, label
+	SynRsBranch                 // blez rs, label
+	SynJump                     // j target
+)
+
+// ImmKind 是 16 位立即数的解释方式
+type ImmKind int
+
+const (
+	ImmNone     ImmKind = iota
+	ImmSigned           // 符号扩展
+	ImmUnsigned         // 零扩展（andi/ori/xori）
+	ImmUpper            // lui 的高 16 位，有符号、无符号写法均可
+)
+
+// Spec 描述一条基本指令
+type Spec struct {
+	Name   string
+	Match  uint32 // 固定位的取值，汇编时在此基础上填入操作数字段
+	Mask   uint32 // 固定位
+	Syntax Syntax
+	Imm    ImmKind
+	Access uint32 // 访存宽度（字节），非访存指令为 0
+}
+
+// Fields 是按 R/I/J 格式拆出的各字段
+type Fields struct {
+	Op, Rs, Rt, Rd, Shamt, Funct uint32
+	Imm                          uint32 // 低 16 位
+	Target                       uint32 // 低 26 位
+}
+
+// Split 拆分指令字的各字段
+func Split(word uint32) Fields {
+	return Fields{
+		Op:     word >> 26,
+		Rs:     (word >> 21) & 0x1f,
+		Rt:     (word >> 16) & 0x1f,
+		Rd:     (word >> 11) & 0x1f,
+		Shamt:  (word >> 6) & 0x1f,
+		Funct:  word & 0x3f,
+		Imm:    word & 0xffff,
+		Target: word & 0x03ffffff,
+	}
+}
+
+// 各编码空间的固定位
+const (
+	maskOp     = 0xfc000000
+	maskFunct  = maskOp | 0x3f     // SPECIAL、SPECIAL2：opcode 与 funct
+	maskRegimm = maskOp | 0x1f<<16 // REGIMM：opcode 与 rt
+	maskCop0   = maskOp | 0x1f<<21 // COP0：opcode 与 rs
+	opSpecial  = 0x00
+	opRegimm   = 0x01
+	opCop0     = 0x10
+	opSpecial2 = 0x1c
+)
+
+func special(name string, funct uint32, syn Syntax) Spec {
+	return Spec{Name: name, Match: opSpecial<<26 | funct, Mask: maskFunct, Syntax: syn}
+}
+
+func special2(name string, funct uint32, syn Syntax) Spec {
+	return Spec{Name: name, Match: opSpecial2<<26 | funct, Mask: maskFunct, Syntax: syn}
+}
+
+func regimm(name string, rt uint32, syn Syntax, imm ImmKind) Spec {
+	return Spec{Name: name, Match: opRegimm<<26 | rt<<16, Mask: maskRegimm, Syntax: syn, Imm: imm}
+}
+
+func cop0(name string, rs uint32, syn Syntax) Spec {
+	return Spec{Name: name, Match: opCop0<<26 | rs<<21, Mask: maskCop0, Syntax: syn}
+}
+
+func itype(name string, op uint32, syn Syntax, imm ImmKind) Spec {
+	return Spec{Name: name, Match: op << 26, Mask: maskOp, Syntax: syn, Imm: imm}
+}
+
+func mem(name string, op uint32, access uint32) Spec {
+	return Spec{Name: name, Match: op << 26, Mask: maskOp, Syntax: SynMem, Imm: ImmSigned, Access: access}
+}
+
+// Instructions 是全部基本指令，按编码空间排列
+var Instructions = []Spec{
+	// 整个字固定的指令，须先于同编码空间的其他指令匹配
+	{Name: "nop", Match: 0x00000000, Mask: 0xffffffff, Syntax: SynNone},
+	{Name: "eret", Match: 0x42000018, Mask: 0xffffffff, Syntax: SynNone},
+
+	special("sll", 0x00, SynRdRtSa),
+	special("srl", 0x02, SynRdRtSa),
+	special("sra", 0x03, SynRdRtSa),
+	special("sllv", 0x04, SynRdRtRs),
+	special("srlv", 0x06, SynRdRtRs),
+	special("srav", 0x07, SynRdRtRs),
+	special("jr", 0x08, SynRs),
+	special("jalr", 0x09, SynJalr),
+	special("movz", 0x0a, SynRdRsRt),
+	special("movn", 0x0b, SynRdRsRt),
+	special("syscall", 0x0c, SynNone),
+	special("break", 0x0d, SynCode),
+	special("mfhi", 0x10, SynRd),
+	special("mthi", 0x11, SynRs),
+	special("mflo", 0x12, SynRd),
+	special("mtlo", 0x13, SynRs),
+	special("mult", 0x18, SynRsRt),
+	special("multu", 0x19, SynRsRt),
+	special("div", 0x1a, SynRsRt),
+	special("divu", 0x1b, SynRsRt),
+	special("add", 0x20, SynRdRsRt),
+	special("addu", 0x21, SynRdRsRt),
+	special("sub", 0x22, SynRdRsRt),
+	special("subu", 0x23, SynRdRsRt),
+	special("and", 0x24, SynRdRsRt),
+	special("or", 0x25, SynRdRsRt),
+	special("xor", 0x26, SynRdRsRt),
+	special("nor", 0x27, SynRdRsRt),
+	special("slt", 0x2a, SynRdRsRt),
+	special("sltu", 0x2b, SynRdRsRt),
+	special("tge", 0x30, SynRsRt),
+	special("tgeu", 0x31, SynRsRt),
+	special("tlt", 0x32, SynRsRt),
+	special("tltu", 0x33, SynRsRt),
+	special("teq", 0x34, SynRsRt),
+	special("tne", 0x36, SynRsRt),
+
+	special2("madd", 0x00, SynRsRt),
+	special2("maddu", 0x01, SynRsRt),
+	special2("mul", 0x02, SynRdRsRt),
+	special2("msub", 0x04, SynRsRt),
+	special2("msubu", 0x05, SynRsRt),
+	special2("clz", 0x20, SynRdRs),
+	special2("clo", 0x21, SynRdRs),
+
+	regimm("bltz", 0x00, SynRsBranch, ImmSigned),
+	regimm("bgez", 0x01, SynRsBranch, ImmSigned),
+	regimm("tgei", 0x08, SynRsImm, ImmSigned),
+	regimm("tgeiu", 0x09, SynRsImm, ImmSigned), // 同样符号扩展，按无符号比较
+	regimm("tlti", 0x0a, SynRsImm, ImmSigned),
+	regimm("tltiu", 0x0b, SynRsImm, ImmSigned),
+	regimm("teqi", 0x0c, SynRsImm, ImmSigned),
+	regimm("tnei", 0x0e, SynRsImm, ImmSigned),
+	regimm("bltzal", 0x10, SynRsBranch, ImmSigned),
+	regimm("bgezal", 0x11, SynRsBranch, ImmSigned),
+
+	cop0("mfc0", 0x00, SynRtCop),
+	cop0("mtc0", 0x04, SynRtCop),
+
+	{Name: "j", Match: 0x02 << 26, Mask: maskOp, Syntax: SynJump},
+	{Name: "jal", Match: 0x03 << 26, Mask: maskOp, Syntax: SynJump},
+
+	itype("beq", 0x04, SynRsRtBranch, ImmSigned),
+	itype("bne", 0x05, SynRsRtBranch, ImmSigned),
+	itype("blez", 0x06, SynRsBranch, ImmSigned),
+	itype("bgtz", 0x07, SynRsBranch, ImmSigned),
+	itype("addi", 0x08, SynRtRsImm, ImmSigned),
+	itype("addiu", 0x09, SynRtRsImm, ImmSigned),
+	itype("slti", 0x0a, SynRtRsImm, ImmSigned),
+	itype("sltiu", 0x0b, SynRtRsImm, ImmSigned),
+	itype("andi", 0x0c, SynRtRsImm, ImmUnsigned),
+	itype("ori", 0x0d, SynRtRsImm, ImmUnsigned),
+	itype("xori", 0x0e, SynRtRsImm, ImmUnsigned),
+	itype("lui", 0x0f, SynRtImm, ImmUpper),
+
+	mem("lb", 0x20, 1),
+	mem("lh", 0x21, 2),
+	mem("lwl", 0x22, 1), // 非对齐访存指令本身允许任意地址
+	mem("lw", 0x23, 4),
+	mem("lbu", 0x24, 1),
+	mem("lhu", 0x25, 2),
+	mem("lwr", 0x26, 1),
+	mem("sb", 0x28, 1),
+	mem("sh", 0x29, 2),
+	mem("swl", 0x2a, 1),
+	mem("sw", 0x2b, 4),
+	mem("swr", 0x2e, 1),
+}
+
+var (
+	byName = map[string]*Spec{}
+	// decodeOrder 按固定位从多到少排列，使 nop、eret 先于 sll、mfc0 等匹配
+	decodeOrder []*Spec
+)
+
+func init() {
+	for i := range Instructions {
+		s := &Instructions[i]
+		if _, dup := byName[s.Name]; dup {
+			panic(fmt.Sprintf("isa: 指令 %s 重复定义", s.Name))
+		}
+		byName[s.Name] = s
+		decodeOrder = append(decodeOrder, s)
+	}
+	sort.SliceStable(decodeOrder, func(i, j int) bool {
+		return bits.OnesCount32(decodeOrder[i].Mask) > bits.OnesCount32(decodeOrder[j].Mask)
+	})
+}
+
+// Lookup 按助记符（小写）查找指令
+func Lookup(name string) (*Spec, bool) {
+	s, ok := byName[name]
+	return s, ok
+}
+
+// Decode 识别指令字，未知编码返回 nil
+func Decode(word uint32) *Spec {
+	for _, s := range decodeOrder {
+		if word&s.Mask == s.Match {
+			return s
+		}
+	}
+	return nil
+}
+
+// 各操作数所在的位
+const (
+	bitsRs     = 0x1f << 21
+	bitsRt     = 0x1f << 16
+	bitsRd     = 0x1f << 11
+	bitsShamt  = 0x1f << 6
+	bitsImm    = 0xffff
+	bitsCode   = 0xfffff << 6
+	bitsTarget = 0x03ffffff
+)
+
+// Operands 返回该写法的操作数所填写的位
+func (s Syntax) Operands() uint32 {
+	switch s {
+	case SynRdRsRt, SynRdRtRs:
+		return bitsRd | bitsRs | bitsRt
+	case SynRdRtSa:
+		return bitsRd | bitsRt | bitsShamt
+	case SynRdRs, SynJalr:
+		return bitsRd | bitsRs
+	case SynRsRt:
+		return bitsRs | bitsRt
+	case SynRs:
+		return bitsRs
+	case SynRd:
+		return bitsRd
+	case SynCode:
+		return bitsCode
+	case SynRtCop:
+		return bitsRt | bitsRd
+	case SynRtRsImm, SynMem, SynRsRtBranch:
+		return bitsRt | bitsRs | bitsImm
+	case SynRtImm:
+		return bitsRt | bitsImm
+	case SynRsImm, SynRsBranch:
+		return bitsRs | bitsImm
+	case SynJump:
+		return bitsTarget
+	}
+	return 0
+}
+
+// Canonical 报告 word 除固定位与操作数位外是否全为 0，即汇编器由其反汇编结果能否得到同一个字
+func (s *Spec) Canonical(word uint32) bool {
+	return word&^(s.Mask|s.Syntax.Operands()) == 0
+}
+
+// Use 返回指令字 word 读取与写入的通用寄存器，各自不重复。
+// 不含 HI/LO 与协处理器寄存器；目的寄存器为 $zero 时 $zero 也列为写入。
+func (s *Spec) Use(word uint32) (reads, writes []uint32) {
+	f := Split(word)
+	switch s.Syntax {
+	case SynRdRsRt:
+		reads, writes = []uint32{f.Rs, f.Rt}, []uint32{f.Rd}
+	case SynRdRtRs:
+		reads, writes = []uint32{f.Rt, f.Rs}, []uint32{f.Rd}
+	case SynRdRtSa:
+		reads, writes = []uint32{f.Rt}, []uint32{f.Rd}
+	case SynRdRs, SynJalr:
+		reads, writes = []uint32{f.Rs}, []uint32{f.Rd}
+	case SynRsRt, SynRsRtBranch:
+		reads = []uint32{f.Rs, f.Rt}
+	case SynRs, SynRsImm:
+		reads = []uint32{f.Rs}
+	case SynRd:
+		writes = []uint32{f.Rd}
+	case SynRtCop:
+		if s.Name == "mfc0" {
+			writes = []uint32{f.Rt}
+		} else {
+			reads = []uint32{f.Rt}
+		}
+	case SynRtRsImm:
+		reads, writes = []uint32{f.Rs}, []uint32{f.Rt}
+	case SynRtImm:
+		writes = []uint32{f.Rt}
+	case SynMem:
+		switch {
+		case s.Name == "lwl" || s.Name == "lwr":
+			// 只替换部分字节，原值也被读取
+			reads, writes = []uint32{f.Rs, f.Rt}, []uint32{f.Rt}
+		case strings.HasPrefix(s.Name, "l"):
+			reads, writes = []uint32{f.Rs}, []uint32{f.Rt}
+		default:
+			reads = []uint32{f.Rs, f.Rt}
+		}
+	case SynRsBranch:
+		reads = []uint32{f.Rs}
+		if s.Name == "bltzal" || s.Name == "bgezal" {
+			writes = []uint32{31}
+		}
+	case SynJump:
+		if s.Name == "jal" {
+			writes = []uint32{31}
+		}
+	}
+	return dedup(reads), dedup(writes)
+}
+
+// dedup 去掉重复的寄存器，保留首次出现的位置
+func dedup(rs []uint32) []uint32 {
+	var out []uint32
+	for _, r := range rs {
+		seen := false
+		for _, o := range out {
+			seen = seen || o == r
+		}
+		if !seen {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// RegNames 为通用寄存器的约定名
+var RegNames = [32]string{
+	"$zero", "$at", "$v0", "$v1",
+	"$a0", "$a1", "$a2", "$a3",
+	"$t0", "$t1", "$t2", "$t3", "$t4", "$t5", "$t6", "$t7",
+	"$s0", "$s1", "$s2", "$s3", "$s4", "$s5", "$s6", "$s7",
+	"$t8", "$t9", "$k0", "$k1", "$gp", "$sp", "$fp", "$ra",
+}
+
+// RegName 返回寄存器 n 的约定名
+func RegName(n uint32) string {
+	if n < 32 {
+		return RegNames[n]
+	}
+	return fmt.Sprintf("$r%d", n)
+}
@@ -0,0 +1,59 @@
+package isa
+
+import (
+	"fmt"
+	"testing"
+)
+
+// sample 在 s 的固定位上填入一组非零操作数：rs=$t1、rt=$t2、rd=$t0、shamt=3、imm=4
+func sample(s *Spec) uint32 {
+	return s.Match | (9<<21|10<<16|8<<11|3<<6|4)&s.Syntax.Operands()
+}
+
+// TestInstructions 确认表中每条指令都能按名字查到，且其编码被识别为它本身
+func TestInstructions(t *testing.T) {
+	for i := range Instructions {
+		s := &Instructions[i]
+		if got, ok := Lookup(s.Name); !ok || got.Name != s.Name {
+			t.Errorf("Lookup(%q) = %v, %v", s.Name, got, ok)
+		}
+		w := sample(s)
+		if d := Decode(w); d == nil || d.Name != s.Name {
+			t.Errorf("%s 的编码 %08x 被识别为 %v", s.Name, w, d)
+		}
+		if !s.Canonical(w) {
+			t.Errorf("%s: %08x 应为规范编码", s.Name, w)
+		}
+		// 保留位非零时不是规范编码
+		if free := ^(s.Mask | s.Syntax.Operands()); free != 0 && s.Canonical(w|free) {
+			t.Errorf("%s: %08x 不应为规范编码", s.Name, w|free)
+		}
+	}
+	if Decode(0xfc000000) != nil {
+		t.Error("未知编码应返回 nil")
+	}
+}
+
+func TestUse(t *testing.T) {
+	cases := []struct {
+		word          uint32
+		reads, writes string
+	}{
+		{0x01084020, "[8]", "[8]"},   // add $t0, $t0, $t0
+		{0x8fa8fffc, "[29]", "[8]"},  // lw $t0, -4($sp)
+		{0xad09000c, "[8 9]", "[]"},  // sw $t1, 12($t0)
+		{0x89280003, "[9 8]", "[8]"}, // lwl $t0, 3($t1)
+		{0x0c000c00, "[]", "[31]"},   // jal
+		{0x0510ffff, "[8]", "[31]"},  // bltzal $t0
+		{0x401a7000, "[]", "[26]"},   // mfc0 $k0, $14
+		{0x40886000, "[8]", "[]"},    // mtc0 $t0, $12
+		{0x3c010000, "[]", "[1]"},    // lui $at, 0
+		{0x00000020, "[0]", "[0]"},   // add $zero, $zero, $zero
+	}
+	for _, c := range cases {
+		rs, ws := Decode(c.word).Use(c.word)
+		if got := fmt.Sprint(rs) + fmt.Sprint(ws); got != c.reads+c.writes {
+			t.Errorf("%08x 读写 %v %v，期望 %s %s", c.word, rs, ws, c.reads, c.writes)
+		}
+	}
+}
@@ -2,6 +2,21 @@ module judger
 
 go 1.24.0
 
-require mipsim v0.0.0
+require (
+	memcfg v0.0.0
+	mips2hex v0.0.0
+	mipsim v0.0.0
+)
 
-replace mipsim => ../mipsim
+require (
+	hex2mips v0.0.0 // indirect
+	isa v0.0.0 // indirect
+)
+
+replace (
+	hex2mips => ../hex2mips
+	isa => ../isa
+	memcfg => ../memcfg
+	mips2hex => ../mips2hex
+	mipsim => ../mipsim
+)
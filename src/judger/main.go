@@ -8,6 +8,7 @@ import (
 
 	"judger/logisim"
 	"judger/verilog"
+	"mips2hex/assembler"
 )
 
 func main() {
@@ -18,7 +19,7 @@ func main() {
 	switch *mode {
 	case "logisim":
 		if len(args) < 3 {
-			fmt.Fprintln(os.Stderr, "Usage: judger -mode logisim <jar_path> <circ_path> <hex_path> [output_path]")
+			fmt.Fprintln(os.Stderr, "Usage: judger -mode logisim <jar_path> <circ_path> <hex_path|source.s> [output_path]")
 			os.Exit(2)
 		}
 		jar := args[0]
@@ -29,11 +30,31 @@ func main() {
 			out = args[3]
 		}
 
+		var prog *assembler.Program
+		if assembler.IsSource(hex) {
+			tmp, p, err := assembleProgram(hex)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Judge error:", err)
+				os.Exit(1)
+			}
+			hex, prog = tmp, p
+		}
+
 		res, err := logisim.JudgeLogisim(jar, circ, hex)
+		if prog != nil {
+			os.Remove(hex)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Judge error:", err)
 			os.Exit(1)
 		}
+		if prog != nil {
+			pcs := make([]uint32, len(res.MipsLines))
+			for i, ml := range res.MipsLines {
+				pcs[i] = ml.PC
+			}
+			res.Diffs = annotate(res.Diffs, pcs, prog)
+		}
 		// Write result lines to output (file or stdout)
 		if out == "" {
 			fmt.Fprintln(os.Stdout, strings.Join(res.Diffs, "\n"))
@@ -51,8 +72,14 @@ func main() {
 		detailPath := "detail.log"
 		var b strings.Builder
 		for i, ml := range res.MipsLines {
-			fmt.Fprintf(&b, "line %d: Instr=0x%08x PC=0x%08x RegWrite=%v RegDest=%d RegData=0x%08x MemWrite=%v MemAddr=0x%08x MemData=0x%08x\n",
+			fmt.Fprintf(&b, "line %d: Instr=0x%08x PC=0x%08x RegWrite=%v RegDest=%d RegData=0x%08x MemWrite=%v MemAddr=0x%08x MemData=0x%08x",
 				i+1, ml.Instr, ml.PC, ml.RegWrite, ml.RegDest, ml.RegData, ml.MemWrite, ml.MemAddr, ml.MemData)
+			if prog != nil {
+				if src, ok := prog.Source(ml.PC); ok {
+					fmt.Fprintf(&b, "    [%s]", src)
+				}
+			}
+			b.WriteString("\n")
 		}
 		if err := os.WriteFile(detailPath, []byte(b.String()), 0644); err != nil {
 			fmt.Fprintln(os.Stderr, "write detail.log error:", err)
@@ -61,7 +88,7 @@ func main() {
 		os.Exit(1)
 	case "verilog":
 		if len(args) < 7 {
-			fmt.Fprintln(os.Stderr, "Usage: judger -mode verilog <ise_path> <verilog_path> <prj_path> <tb_path> <tcl_path> <hex_path> <output_path>")
+			fmt.Fprintln(os.Stderr, "Usage: judger -mode verilog <ise_path> <verilog_path> <prj_path> <tb_path> <tcl_path> <hex_path|source.s> <output_path>")
 			os.Exit(2)
 		}
 		ise := args[0]
@@ -72,7 +99,20 @@ func main() {
 		hex := args[5]
 		out := args[6]
 
+		fromSource := assembler.IsSource(hex)
+		if fromSource {
+			tmp, _, err := assembleProgram(hex)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Judge error:", err)
+				os.Exit(1)
+			}
+			hex = tmp
+		}
+
 		res, err := verilog.JudgeVerilog(ise, verilogPath, prjfile, tbfile, tclfile, hex)
+		if fromSource {
+			os.Remove(hex)
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, "Judge error:", err)
 			os.Exit(1)
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"memcfg"
+	"mips2hex/assembler"
+	"mips2hex/diag"
+)
+
+// assembleProgram assembles a source file with the course memory layout (the one
+// mipsim uses when judging) and writes its text image to a temporary hex file that
+// the judges can consume unchanged. The caller removes the file when done.
+func assembleProgram(path string) (string, *assembler.Program, error) {
+	cfg := memcfg.Course
+	prog, diags := assembler.AssembleFile(path, assembler.Options{
+		Layout: assembler.Layout{TextBase: cfg.TextBase, DataBase: cfg.DataBase},
+		Mode:   assembler.CheckWarn,
+	})
+	diag.Print(os.Stderr, diags)
+	if diags.HasErrors() {
+		return "", nil, fmt.Errorf("assemble %s failed", path)
+	}
+	// Only the instruction memory is loaded into the CPU under test, so initialized
+	// data would make the two traces diverge for reasons unrelated to the CPU.
+	for _, w := range prog.Data {
+		if w != 0 {
+			return "", nil, fmt.Errorf("%s: initialized .data is not supported when judging; use .space or store the values at runtime", path)
+		}
+	}
+
+	f, err := os.CreateTemp("", "judger-*.hex")
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	for _, w := range prog.Text {
+		if _, err := fmt.Fprintf(f, "%08x\n", w); err != nil {
+			os.Remove(f.Name())
+			return "", nil, err
+		}
+	}
+	return f.Name(), prog, nil
+}
+
+// annotate appends the source line of the instruction each "line N ..." diff refers
+// to, where pcs[N-1] is the PC of trace line N.
+func annotate(diffs []string, pcs []uint32, prog *assembler.Program) []string {
+	out := make([]string, len(diffs))
+	for i, d := range diffs {
+		out[i] = d
+		var n int
+		if _, err := fmt.Sscanf(d, "line %d", &n); err != nil || n < 1 || n > len(pcs) {
+			continue
+		}
+		if src, ok := prog.Source(pcs[n-1]); ok {
+			out[i] = fmt.Sprintf("%s    [%s]", d, src)
+		}
+	}
+	return out
+}
@@ -0,0 +1,3 @@
+module memcfg
+
+go 1.24.0
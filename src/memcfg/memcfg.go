@@ -0,0 +1,89 @@
+// Package memcfg 定义汇编器、反汇编器与仿真器共用的内存布局，
+// 对应 MARS 的 Settings > Memory Configuration，另加本课程 CPU 的 IM@0x3000/DM@0x0000。
+package memcfg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Config 是一种内存布局
+type Config struct {
+	Name     string
+	Desc     string
+	TextBase uint32 // .text 段基址，即 PC 初值
+	DataBase uint32 // .data 段基址
+	GP       uint32 // $gp 初值
+	SP       uint32 // $sp 初值
+	// ExcHandler 为异常入口：syscall、break、自陷等异常发生时 PC 跳转到此处
+	ExcHandler uint32
+}
+
+var (
+	// Default 为 MARS 默认布局
+	Default = Config{Name: "default", Desc: "MARS 默认布局", TextBase: 0x00400000, DataBase: 0x10010000, GP: 0x10008000, SP: 0x7fffeffc, ExcHandler: 0x80000180}
+	// CompactDataAtZero 为 MARS 的 Compact, Data at Address 0
+	CompactDataAtZero = Config{Name: "compact-data", Desc: "MARS 紧凑布局，数据在 0 地址", TextBase: 0x00003000, DataBase: 0x00000000, GP: 0x00001800, SP: 0x00002ffc, ExcHandler: 0x00004180}
+	// CompactTextAtZero 为 MARS 的 Compact, Text at Address 0
+	CompactTextAtZero = Config{Name: "compact-text", Desc: "MARS 紧凑布局，代码在 0 地址", TextBase: 0x00000000, DataBase: 0x00002000, GP: 0x00003800, SP: 0x00003ffc, ExcHandler: 0x00004180}
+	// Course 为本课程 CPU 的布局：IM 从 0x3000、DM 从 0x0000 开始，寄存器初值全为 0
+	Course = Config{Name: "course", Desc: "课程 CPU：IM@0x3000，DM@0x0000，寄存器初值为 0", TextBase: 0x00003000, DataBase: 0x00000000, ExcHandler: 0x00004180}
+)
+
+var configs = map[string]Config{}
+
+func init() {
+	for _, c := range []Config{Default, CompactDataAtZero, CompactTextAtZero, Course} {
+		configs[c.Name] = c
+	}
+}
+
+// Lookup 按名字查找布局，不区分大小写
+func Lookup(name string) (Config, error) {
+	c, ok := configs[strings.ToLower(name)]
+	if !ok {
+		return Config{}, fmt.Errorf("未知内存布局 %s（可选: %s）", name, strings.Join(Names(), ", "))
+	}
+	return c, nil
+}
+
+// Resolve 确定命令行给出的布局：先取名为 name 的布局（name 为空时各地址为 0），
+// 再以非 nil 的 text/data 覆盖 .text/.data 基址，即显式给出的 -base/-database 优先于 -mem
+func Resolve(name string, text, data *uint32) (Config, error) {
+	var c Config
+	if name != "" {
+		var err error
+		if c, err = Lookup(name); err != nil {
+			return Config{}, err
+		}
+	}
+	if text != nil {
+		c.TextBase = *text
+	}
+	if data != nil {
+		c.DataBase = *data
+	}
+	return c, nil
+}
+
+// Names 返回全部布局名，按字母序
+func Names() []string {
+	names := make([]string, 0, len(configs))
+	for name := range configs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Usage 返回供命令行 -mem 参数使用的说明
+func Usage() string {
+	var b strings.Builder
+	b.WriteString("内存布局:")
+	for _, name := range Names() {
+		c := configs[name]
+		fmt.Fprintf(&b, "\n  %-13s .text=0x%08x .data=0x%08x  %s", c.Name, c.TextBase, c.DataBase, c.Desc)
+	}
+	return b.String()
+}
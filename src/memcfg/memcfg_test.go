@@ -0,0 +1,62 @@
+package memcfg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	for _, c := range []Config{Default, CompactDataAtZero, CompactTextAtZero, Course} {
+		got, err := Lookup(strings.ToUpper(c.Name))
+		if err != nil || got != c {
+			t.Errorf("Lookup(%q) = %+v, %v，期望 %+v", c.Name, got, err, c)
+		}
+	}
+	if len(Names()) != 4 {
+		t.Errorf("布局数不正确: %v", Names())
+	}
+
+	_, err := Lookup("mars")
+	if err == nil {
+		t.Fatal("未知布局应报错")
+	}
+	for _, name := range Names() {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("错误信息应列出可选布局 %s: %v", name, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	u := func(v uint32) *uint32 { return &v }
+	tests := []struct {
+		name       string
+		text, data *uint32
+		want       [2]uint32
+	}{
+		{"", nil, nil, [2]uint32{0, 0}},
+		{"", u(0x3000), nil, [2]uint32{0x3000, 0}},
+		{"course", nil, nil, [2]uint32{0x3000, 0}},
+		{"default", nil, nil, [2]uint32{0x00400000, 0x10010000}},
+		// 显式给出的基址覆盖 -mem，未给出的一侧仍取自布局
+		{"default", u(0), nil, [2]uint32{0, 0x10010000}},
+		{"default", nil, u(0x2000), [2]uint32{0x00400000, 0x2000}},
+		{"compact-text", u(0x100), u(0x200), [2]uint32{0x100, 0x200}},
+	}
+	for _, tt := range tests {
+		c, err := Resolve(tt.name, tt.text, tt.data)
+		if err != nil {
+			t.Fatalf("Resolve(%q) 失败: %v", tt.name, err)
+		}
+		if got := [2]uint32{c.TextBase, c.DataBase}; got != tt.want {
+			t.Errorf("Resolve(%q) 基址为 %x，期望 %x", tt.name, got, tt.want)
+		}
+	}
+	// 覆盖基址不影响布局中的其余地址
+	if c, _ := Resolve("default", u(0), nil); c.SP != Default.SP || c.GP != Default.GP {
+		t.Errorf("覆盖基址后 $gp/$sp 不应改变: %+v", c)
+	}
+	if _, err := Resolve("nope", u(0), nil); err == nil {
+		t.Error("未知布局即使给出基址也应报错")
+	}
+}
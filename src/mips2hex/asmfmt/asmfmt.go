@@ -0,0 +1,250 @@
+// Package asmfmt 把 MIPS 汇编源码改写为统一的格式：标签顶格，助记符与操作数按列对齐，
+// 操作数以 ", " 分隔，寄存器名统一写法，行尾注释对齐到同一列。
+// 输出再次格式化时保持不变。
+package asmfmt
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"isa"
+	"mips2hex/lexer"
+	"mips2hex/parser"
+	"mips2hex/pseudo"
+	"mips2hex/regs"
+)
+
+// RegStyle 是寄存器名的写法
+type RegStyle int
+
+const (
+	RegKeep    RegStyle = iota // 保持原样
+	RegABI                     // $t0
+	RegNumeric                 // $8
+)
+
+// ParseRegStyle 解析命令行中的寄存器写法：keep、abi 或 numeric
+func ParseRegStyle(s string) (RegStyle, error) {
+	switch s {
+	case "keep":
+		return RegKeep, nil
+	case "abi":
+		return RegABI, nil
+	case "numeric":
+		return RegNumeric, nil
+	}
+	return 0, fmt.Errorf("未知的寄存器写法 %s，可选 keep、abi、numeric", s)
+}
+
+// DefaultCommentCol 是行尾注释默认的起始列（从 0 计）
+const DefaultCommentCol = 40
+
+// Options 是格式化参数
+type Options struct {
+	Regs       RegStyle
+	CommentCol int // 行尾注释的起始列，0 时取 DefaultCommentCol；代码更长时注释前留一个空格
+}
+
+// 标签列宽与助记符列宽的范围：列宽按文件中最长的标签与助记符确定，
+// 标签超出上限时单独占一行
+const (
+	minIndent, maxIndent   = 8, 16
+	minOpWidth, maxOpWidth = 6, 10
+)
+
+var labelRe = regexp.MustCompile(`^([A-Za-z_\.][A-Za-z0-9_\.\$]*|[0-9]+):`)
+
+// line 是拆分后的一行
+type line struct {
+	verbatim bool     // 无法切分的行原样输出
+	text     string   // verbatim 时的原文
+	labels   string   // 行首标签，如 "a: b:"
+	op       string   // 助记符或伪指令名
+	args     []string // 已规范化的操作数
+	comment  string
+	indented bool // 仅含注释的行是否缩进
+}
+
+// Source 格式化源码 src，返回以换行结尾的结果
+func Source(src string, opts Options) string {
+	if opts.CommentCol == 0 {
+		opts.CommentCol = DefaultCommentCol
+	}
+	var lines []line
+	indent, opWidth := minIndent, minOpWidth
+	for _, raw := range strings.Split(src, "\n") {
+		l := split(strings.TrimSuffix(raw, "\r"), opts.Regs)
+		indent = max(indent, min(len(l.labels)+1, maxIndent))
+		if len(l.args) > 0 {
+			opWidth = max(opWidth, min(len(l.op)+1, maxOpWidth))
+		}
+		lines = append(lines, l)
+	}
+
+	var b strings.Builder
+	blank := true // 去掉开头的空行，连续空行合并为一行
+	for _, l := range lines {
+		var s string
+		switch {
+		case l.verbatim:
+			s = l.text
+		case l.labels == "" && l.op == "" && l.comment == "":
+			if !blank {
+				b.WriteString("\n")
+			}
+			blank = true
+			continue
+		case l.labels == "" && l.op == "":
+			if l.indented {
+				s = strings.Repeat(" ", indent)
+			}
+			s += l.comment
+		default:
+			s = l.labels
+			if l.op != "" {
+				if len(l.labels)+1 > indent {
+					b.WriteString(s + "\n")
+					s = ""
+				}
+				s = pad(s, indent) + l.op
+				if len(l.args) > 0 {
+					s = pad(s, indent+opWidth) + strings.Join(l.args, ", ")
+				}
+			}
+			if l.comment != "" {
+				s = pad(s, opts.CommentCol) + l.comment
+			}
+		}
+		b.WriteString(strings.TrimRight(s, " \t") + "\n")
+		blank = false
+	}
+	out := b.String()
+	for strings.HasSuffix(out, "\n\n") {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+// pad 以空格把 s 补到 n 列，s 不短于 n 时补一个空格
+func pad(s string, n int) string {
+	if s == "" {
+		return strings.Repeat(" ", n)
+	}
+	if len(s) >= n {
+		return s + " "
+	}
+	return s + strings.Repeat(" ", n-len(s))
+}
+
+// split 拆出一行的标签、语句与注释
+func split(raw string, style RegStyle) line {
+	code := lexer.StripComment(raw)
+	if _, err := lexer.Lex(code); err != nil {
+		return line{verbatim: true, text: strings.TrimRight(raw, " \t")}
+	}
+	l := line{comment: strings.TrimSpace(raw[len(code):])}
+	code = strings.TrimSpace(code)
+	if code == "" {
+		l.indented = strings.TrimLeft(raw, " \t") != raw
+		return l
+	}
+	var labels []string
+	for {
+		m := labelRe.FindStringSubmatch(code)
+		if m == nil {
+			break
+		}
+		labels = append(labels, m[0])
+		code = strings.TrimSpace(code[len(m[0]):])
+	}
+	l.labels = strings.Join(labels, " ")
+	if code == "" {
+		return l
+	}
+	toks, err := parser.Tokenize(code)
+	if err != nil || len(toks) == 0 {
+		return line{verbatim: true, text: strings.TrimRight(raw, " \t")}
+	}
+	l.op = toks[0]
+	if lower := strings.ToLower(l.op); strings.HasPrefix(lower, ".") || pseudo.Known(lower) {
+		l.op = lower
+	} else if _, ok := isa.Lookup(lower); ok {
+		l.op = lower
+	}
+	rest := code[len(toks[0]):]
+	switch {
+	case strings.HasPrefix(l.op, "."):
+		// 伪指令的操作数可以以空白分隔（.eqv N 3），不改为逗号
+		if rest = strings.TrimSpace(rest); rest != "" {
+			l.args = []string{normalize(rest, style, false, false)}
+		}
+		return l
+	case strings.HasPrefix(rest, "("):
+		// 宏调用 name(a, b) 保持紧凑写法
+		l.op += normalize(rest, style, true, true)
+		return l
+	}
+	for i, a := range toks[1:] {
+		// mfc0/mtc0 的第二个操作数是协处理器寄存器号，保持数字写法
+		cop := i == 1 && (l.op == "mfc0" || l.op == "mtc0")
+		l.args = append(l.args, normalize(a, style, !cop, true))
+	}
+	return l
+}
+
+// normalize 重新拼接操作数的记号：空白合并为一个空格，逗号后接一个空格，
+// rename 为真时按 style 改写寄存器名。compact 为真时（指令与宏调用的操作数）
+// 去掉括号与运算符两侧的空白，使 4 ( $sp ) 与 4($sp) 格式化结果相同
+func normalize(s string, style RegStyle, rename, compact bool) string {
+	toks, err := lexer.Lex(s)
+	if err != nil {
+		return s
+	}
+	var b strings.Builder
+	for i, t := range toks {
+		if i > 0 && t.Text != "," {
+			prev := toks[i-1]
+			spaced := t.Col-1 > prev.End()
+			if compact {
+				spaced = spaced && !joins(prev, t)
+			}
+			if prev.Text == "," || spaced {
+				b.WriteByte(' ')
+			}
+		}
+		if t.Kind == lexer.Register && rename {
+			b.WriteString(regName(t.Text, style))
+		} else {
+			b.WriteString(t.Text)
+		}
+	}
+	return b.String()
+}
+
+// joins 报告 b 能否紧接在 a 之后而不改变分词：至少一侧是标点，
+// 且两个标点不会连成双字符运算符
+func joins(a, b lexer.Token) bool {
+	if a.Kind != lexer.Punct && b.Kind != lexer.Punct {
+		return false
+	}
+	if a.Kind == lexer.Punct && b.Kind == lexer.Punct {
+		relexed, err := lexer.Lex(a.Text + b.Text)
+		return err == nil && len(relexed) == 2
+	}
+	return true
+}
+
+func regName(s string, style RegStyle) string {
+	n, err := regs.RegOf(s)
+	if err != nil {
+		return s
+	}
+	switch style {
+	case RegABI:
+		return isa.RegName(uint32(n))
+	case RegNumeric:
+		return fmt.Sprintf("$%d", n)
+	}
+	return s
+}
@@ -2,382 +2,587 @@ package assembler
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 
+	"isa"
+	"mips2hex/diag"
+	"mips2hex/expr"
+	"mips2hex/pseudo"
 	"mips2hex/regs"
 	"mips2hex/types"
 )
 
-var instrTable = map[string]types.Instruction{
-	"add":   {Type: types.RType, Opcode: 0x00, Funct: 0x20},
-	"addu":  {Type: types.RType, Opcode: 0x00, Funct: 0x21},
-	"sub":   {Type: types.RType, Opcode: 0x00, Funct: 0x22},
-	"subu":  {Type: types.RType, Opcode: 0x00, Funct: 0x23},
-	"and":   {Type: types.RType, Opcode: 0x00, Funct: 0x24},
-	"or":    {Type: types.RType, Opcode: 0x00, Funct: 0x25},
-	"xor":   {Type: types.RType, Opcode: 0x00, Funct: 0x26},
-	"nor":   {Type: types.RType, Opcode: 0x00, Funct: 0x27},
-	"slt":   {Type: types.RType, Opcode: 0x00, Funct: 0x2a},
-	"sltu":  {Type: types.RType, Opcode: 0x00, Funct: 0x2b},
-	"sll":   {Type: types.RType, Opcode: 0x00, Funct: 0x00}, // Special R-type format (rd, rt, shamt)
-	"srl":   {Type: types.RType, Opcode: 0x00, Funct: 0x02}, // Special R-type format (rd, rt, shamt)
-	"sra":   {Type: types.RType, Opcode: 0x00, Funct: 0x03}, // Special R-type format (rd, rt, shamt)
-	"sllv":  {Type: types.RType, Opcode: 0x00, Funct: 0x04}, // Special R-type format (rd, rs, rt)
-	"srlv":  {Type: types.RType, Opcode: 0x00, Funct: 0x06}, // Special R-type format (rd, rs, rt)
-	"srav":  {Type: types.RType, Opcode: 0x00, Funct: 0x07}, // Special R-type format (rd, rs, rt)
-	"jr":    {Type: types.RType, Opcode: 0x00, Funct: 0x08}, // Special R-type format (rs)
-	"jalr":  {Type: types.RType, Opcode: 0x00, Funct: 0x09}, // Special R-type format (rd, rs)
-	"mult":  {Type: types.RType, Opcode: 0x00, Funct: 0x18},
-	"multu": {Type: types.RType, Opcode: 0x00, Funct: 0x19},
-	"div":   {Type: types.RType, Opcode: 0x00, Funct: 0x1a},
-	"divu":  {Type: types.RType, Opcode: 0x00, Funct: 0x1b},
-	"mfhi":  {Type: types.RType, Opcode: 0x00, Funct: 0x10},
-	"mflo":  {Type: types.RType, Opcode: 0x00, Funct: 0x12},
-	"mthi":  {Type: types.RType, Opcode: 0x00, Funct: 0x11},
-	"mtlo":  {Type: types.RType, Opcode: 0x00, Funct: 0x13},
+// Layout 给出各段的基址
+type Layout struct {
+	TextBase uint32
+	DataBase uint32
+}
 
-	"addi":  {Type: types.IType, Opcode: 0x08},
-	"addiu": {Type: types.IType, Opcode: 0x09},
-	"andi":  {Type: types.IType, Opcode: 0x0c},
-	"ori":   {Type: types.IType, Opcode: 0x0d},
-	"xori":  {Type: types.IType, Opcode: 0x0e},
-	"slti":  {Type: types.IType, Opcode: 0x0a},
-	"sltiu": {Type: types.IType, Opcode: 0x0b},
-	"lui":   {Type: types.IType, Opcode: 0x0f}, // Special I-type format (rt, imm)
-	"lw":    {Type: types.IType, Opcode: 0x23}, // Special I-type format rt, offset(base)
-	"lh":    {Type: types.IType, Opcode: 0x21},
-	"lhu":   {Type: types.IType, Opcode: 0x25},
-	"lb":    {Type: types.IType, Opcode: 0x20},
-	"lbu":   {Type: types.IType, Opcode: 0x24},
-	"sw":    {Type: types.IType, Opcode: 0x2b}, // Special I-type format rt, offset(base)
-	"sh":    {Type: types.IType, Opcode: 0x29},
-	"sb":    {Type: types.IType, Opcode: 0x28},
-	"beq":   {Type: types.IType, Opcode: 0x04}, // Special I-type format rs, rt, offset
-	"bne":   {Type: types.IType, Opcode: 0x05}, // Special I-type format rs, rt, offset
-	"blez":  {Type: types.IType, Opcode: 0x06},
-	"bgtz":  {Type: types.IType, Opcode: 0x07},
+// Assemble: 将解析出来的 items 与 label 表翻译为机器码 uint32 列表（仅 .text 段）
+func Assemble(items []types.Item, labels map[string]types.Symbol, base uint32) ([]uint32, error) {
+	text, _, err := AssembleImage(items, labels, Layout{TextBase: base})
+	return text, err
+}
 
-	"j":   {Type: types.JType, Opcode: 0x02},
-	"jal": {Type: types.JType, Opcode: 0x03},
+// AssembleImage 同时生成 .text 段机器码与 .data 段镜像。
+// 数据段按大端序打包为 32 位字，与 mipsim 的 lb/sb 字节序一致，末尾不足一字时补零。
+// 出错的 item 以零填充占位后继续汇编，全部错误以 diag.List 返回。
+// 不检查操作数范围，需要检查时使用 AssembleChecked。
+func AssembleImage(items []types.Item, labels map[string]types.Symbol, layout Layout) ([]uint32, []uint32, error) {
+	text, data, diags := AssembleChecked(items, labels, layout, CheckOff)
+	if err := diags.Err(); err != nil {
+		return nil, nil, err
+	}
+	return text, data, nil
+}
 
-	"li":  {Type: types.Special},
-	"nop": {Type: types.Special},
+// AssembleChecked 同 AssembleImage，并按 mode 检查立即数与偏移范围、分支可达性、
+// 跳转是否跨 256MB 区域以及以 $zero 为基址的访存是否对齐。返回全部诊断（含警告），
+// 存在错误时机器码不可用。
+func AssembleChecked(items []types.Item, labels map[string]types.Symbol, layout Layout, mode CheckMode) ([]uint32, []uint32, diag.List) {
+	return assemble(items, labels, layout, mode, nil, nil)
 }
 
-// Assemble: 将解析出来的 items 与 label 表翻译为机器码 uint32 列表
-func Assemble(items []types.Item, labels map[string]uint32, base uint32) ([]uint32, error) {
+// assemble 实现 AssembleChecked；lst 非空时同时记录清单。
+// rel 非空时生成目标文件：各段从 0 开始，外部符号取 0，引用符号的字段记录到 rel。
+func assemble(items []types.Item, labels map[string]types.Symbol, layout Layout, mode CheckMode, lst *Listing, rel *relocator) ([]uint32, []uint32, diag.List) {
 	var out []uint32
+	var data []byte
+	var diags diag.List
 	addr := uint32(0)
+	items, labels = relax(items, labels, layout, rel != nil)
+	abs := absLabels(labels, layout)
+	base := layout.TextBase
+	if lst != nil {
+		lst.Symbols = symbolTable(labels, abs)
+	}
+	if rel != nil {
+		rel.items, rel.labels = items, labels
+		for name, sym := range labels {
+			if sym.Extern {
+				abs[name] = 0
+			}
+		}
+	}
 
-	for _, it := range items {
+	for i, it := range items {
+		if it.Seg == types.Data {
+			c := &checker{}
+			b, err := assembleData(it, abs, c)
+			if err == nil && rel != nil {
+				err = rel.data(it)
+			}
+			if err != nil {
+				diags = append(diags, it.Diag(diag.Error, err))
+				b = make([]byte, it.Size)
+			} else {
+				diags = append(diags, c.diags(mode, it.Diag)...)
+			}
+			if lst != nil && len(b) > 0 {
+				lst.Entries = append(lst.Entries, Entry{Seg: types.Data, Addr: layout.DataBase + uint32(len(data)), Bytes: b, Item: &items[i], Index: i})
+			}
+			data = append(data, b...)
+			continue
+		}
+		start := len(out)
+		var asm [][]string
 		switch it.Kind {
 		case types.Word:
-			v, err := parseNumber(it.Raw, labels, base)
+			v, err := parseNumber(it.Raw, abs)
+			if err != nil {
+				err = fmt.Errorf("解析 .word %s 失败: %v", it.Raw, err)
+			} else if rel != nil {
+				err = rel.word(types.Text, addr, it.Raw)
+			}
 			if err != nil {
-				return nil, fmt.Errorf("line %d: 解析 .word %s 失败: %v", it.LineNo, it.Raw, err)
+				diags = append(diags, it.Diag(diag.Error, diag.Tok(it.Raw, err)))
 			}
 			out = append(out, v)
 			addr += 4
 
-		case types.Instr:
-			op := strings.ToLower(it.Tokens[0])
-			instr, ok := instrTable[op]
-			if !ok {
-				return nil, fmt.Errorf("line %d: 不支持的指令: %s", it.LineNo, op)
+		case types.Bytes:
+			// .text 中的 .align 填充，按 nop 补齐
+			for i := uint32(0); i < it.Size/4; i++ {
+				out = append(out, 0)
 			}
+			addr += it.Size
 
+		case types.Instr:
 			var words []uint32
 			var err error
-
-			switch instr.Type {
-			case types.RType:
-				words, err = assembleRType(it, instr)
-			case types.IType:
-				words, err = assembleIType(it, instr, labels, addr, base)
-			case types.JType:
-				words, err = assembleJType(it, instr, labels, base)
-			case types.Special:
-				words, err = assembleSpecial(it, labels, base)
-			default:
-				err = fmt.Errorf("line %d: 未知指令类型 for %s", it.LineNo, op)
+			c := &checker{rel: rel}
+			f, ops := pseudo.Lookup(it.Tokens, lookup(abs))
+			if f != nil {
+				words, asm, err = assemblePseudo(it, f, ops, abs, addr, base, c)
+			} else if _, basic := isa.Lookup(strings.ToLower(it.Tokens[0])); !basic && pseudo.OperandErr(ops) != nil {
+				// 只有伪指令写法的助记符因操作数求值失败而无法匹配，报告真正的原因
+				err = pseudo.OperandErr(ops)
+			} else {
+				words, err = assembleInstr(it, abs, addr, base, c)
+				asm = [][]string{it.Tokens}
 			}
-
 			if err != nil {
-				return nil, err
+				diags = append(diags, it.Diag(diag.Error, err))
+				words = make([]uint32, it.Size/4)
+			} else {
+				diags = append(diags, c.diags(mode, it.Diag)...)
+				rel.add(c.fixups, addr)
 			}
 			out = append(out, words...)
 			addr += uint32(len(words) * 4)
 
 		default:
-			return nil, fmt.Errorf("未知 item 类型")
+			diags = append(diags, it.Diag(diag.Error, fmt.Errorf("未知 item 类型")))
+		}
+		if lst != nil {
+			for j, w := range out[start:] {
+				e := Entry{Seg: types.Text, Addr: base + uint32((start+j)*4), Word: w, Item: &items[i], Index: i}
+				switch {
+				case it.Kind == types.Word:
+					e.Asm = ".word " + it.Raw
+				case j < len(asm):
+					e.Asm = formatInstr(asm[j])
+				default:
+					e.Asm = "nop"
+				}
+				lst.Entries = append(lst.Entries, e)
+			}
+		}
+	}
+	return out, packWords(data), diags
+}
+
+// assemblePseudo 按 MARS 的模板展开伪指令，逐条汇编展开后的基本指令。
+// relax 已为每条伪指令确定长度：能用紧凑展开且预留长度不足完整展开时用紧凑展开；
+// 迭代中操作数的值变小导致展开短于预留长度时以 nop 补齐。
+// 同时返回展开后的各条基本指令。
+func assemblePseudo(it types.Item, f *pseudo.Form, ops []pseudo.Operand, labels map[string]uint32, addr uint32, base uint32, c *checker) ([]uint32, [][]string, error) {
+	eval := func(s string) (uint32, error) {
+		v, err := parseNumber(s, labels)
+		return v, diag.Tok(s, err)
+	}
+	fits, err := f.Fits(ops, eval)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s 展开失败: %w", f.Op, err)
+	}
+	compact := fits && it.Size < f.Size(false) && c.rel == nil
+	lines, err := f.Expand(ops, eval, compact)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s 展开失败: %w", f.Op, err)
+	}
+	if err := c.refs(f.Refs(ops, compact)); err != nil {
+		return nil, nil, err
+	}
+	var out []uint32
+	for i, toks := range lines {
+		c.word = i
+		sub := it
+		sub.Tokens = toks
+		words, err := assembleInstr(sub, labels, addr, base, c)
+		if err != nil {
+			return nil, nil, err
+		}
+		out = append(out, words...)
+		addr += uint32(len(words) * 4)
+	}
+	for uint32(len(out)*4) < it.Size {
+		out = append(out, 0)
+	}
+	return out, lines, nil
+}
+
+// lookup 把标签表包装为表达式求值所需的符号查询函数
+func lookup(labels map[string]uint32) func(string) (uint32, bool) {
+	return func(name string) (uint32, bool) {
+		v, ok := labels[name]
+		return v, ok
+	}
+}
+
+// absLabels 按段基址把段内偏移换算为绝对地址
+func absLabels(labels map[string]types.Symbol, layout Layout) map[string]uint32 {
+	abs := make(map[string]uint32, len(labels))
+	for name, sym := range labels {
+		if sym.Extern {
+			// 外部符号只在链接时确定，单文件汇编时视为未定义
+			continue
+		}
+		switch sym.Seg {
+		case types.Data:
+			abs[name] = layout.DataBase + sym.Addr
+		default:
+			abs[name] = layout.TextBase + sym.Addr
+		}
+	}
+	return abs
+}
+
+// assembleData 汇编 .data 段中的一项，.half/.byte 的值超出宽度时经 c 报告
+func assembleData(it types.Item, labels map[string]uint32, c *checker) ([]byte, error) {
+	switch it.Kind {
+	case types.Bytes:
+		return it.Bytes, nil
+	case types.Word, types.Half, types.Byte:
+		v, err := parseNumber(it.Raw, labels)
+		if err != nil {
+			return nil, fmt.Errorf("解析数据 %s 失败: %v", it.Raw, err)
+		}
+		switch it.Kind {
+		case types.Half:
+			v = c.datum(it.Raw, v, 16, ".half 的值")
+		case types.Byte:
+			v = c.datum(it.Raw, v, 8, ".byte 的值")
 		}
+		b := []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+		return b[4-it.Size:], nil
 	}
-	return out, nil
+	return nil, fmt.Errorf(".data 段中不支持的内容")
 }
 
-func assembleRType(it types.Item, instr types.Instruction) ([]uint32, error) {
+func packWords(data []byte) []uint32 {
+	words := make([]uint32, 0, (len(data)+3)/4)
+	for i := 0; i < len(data); i += 4 {
+		var w uint32
+		for j := 0; j < 4; j++ {
+			w <<= 8
+			if i+j < len(data) {
+				w |= uint32(data[i+j])
+			}
+		}
+		words = append(words, w)
+	}
+	return words
+}
+
+// assembleInstr 汇编一条基本指令，编码与操作数写法取自 isa 表
+func assembleInstr(it types.Item, labels map[string]uint32, addr uint32, base uint32, c *checker) ([]uint32, error) {
+	op := strings.ToLower(it.Tokens[0])
+	spec, ok := isa.Lookup(op)
+	if !ok {
+		return nil, diag.Tok(it.Tokens[0], fmt.Errorf("不支持的指令: %s", op))
+	}
+	switch spec.Syntax {
+	case isa.SynJump:
+		return assembleJType(it, spec, labels, addr, base, c)
+	case isa.SynRtRsImm, isa.SynRtImm, isa.SynRsImm, isa.SynMem, isa.SynRsRtBranch, isa.SynRsBranch:
+		return assembleIType(it, spec, labels, addr, base, c)
+	}
+	return assembleRType(it, spec, c)
+}
+
+// assembleRType 汇编只有寄存器、移位量或 code 操作数的指令
+func assembleRType(it types.Item, spec *isa.Spec, c *checker) ([]uint32, error) {
 	toks := it.Tokens
-	op := strings.ToLower(toks[0])
-	var word uint32
+	op := spec.Name
+	word := spec.Match
+	var rr regReader
 
-	switch op {
+	switch spec.Syntax {
+	// Format: op
+	case isa.SynNone:
 	// Format: op rd, rs, rt
-	case "add", "addu", "sub", "subu", "and", "or", "xor", "nor", "slt", "sltu":
+	case isa.SynRdRsRt:
 		if len(toks) < 4 {
-			return nil, fmt.Errorf("line %d: %s 需要 3 个寄存器操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 3 个寄存器操作数", op)
 		}
-		rd := regs.RegOf(toks[1], it.LineNo)
-		rs := regs.RegOf(toks[2], it.LineNo)
-		rt := regs.RegOf(toks[3], it.LineNo)
-		word = (uint32(rs) << 21) | (uint32(rt) << 16) | (uint32(rd) << 11) | instr.Funct
+		rd := rr.reg(toks[1])
+		rs := rr.reg(toks[2])
+		rt := rr.reg(toks[3])
+		word |= (uint32(rs) << 21) | (uint32(rt) << 16) | (uint32(rd) << 11)
 	// Format: op rd, rt, rs (variable shifts)
-	case "sllv", "srlv", "srav":
+	case isa.SynRdRtRs:
 		if len(toks) < 4 {
-			return nil, fmt.Errorf("line %d: %s 需要 3 个寄存器操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 3 个寄存器操作数", op)
 		}
-		rd := regs.RegOf(toks[1], it.LineNo)
-		rt := regs.RegOf(toks[2], it.LineNo)
-		rs := regs.RegOf(toks[3], it.LineNo)
-		word = (uint32(rs) << 21) | (uint32(rt) << 16) | (uint32(rd) << 11) | instr.Funct
+		rd := rr.reg(toks[1])
+		rt := rr.reg(toks[2])
+		rs := rr.reg(toks[3])
+		word |= (uint32(rs) << 21) | (uint32(rt) << 16) | (uint32(rd) << 11)
 	// Format: op rd, rt, shamt
-	case "sll", "srl", "sra":
+	case isa.SynRdRtSa:
 		if len(toks) < 4 {
-			return nil, fmt.Errorf("line %d: %s 需要 rd, rt, shamt", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 rd, rt, shamt", op)
 		}
-		rd := regs.RegOf(toks[1], it.LineNo)
-		rt := regs.RegOf(toks[2], it.LineNo)
-		shamt, err := strconv.Atoi(strings.TrimSpace(toks[3]))
+		rd := rr.reg(toks[1])
+		rt := rr.reg(toks[2])
+		shamt, err := parseNumber(toks[3], nil)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: shamt 解析失败: %v", it.LineNo, err)
+			return nil, diag.Tok(toks[3], fmt.Errorf("shamt 解析失败: %v", err))
 		}
-		word = (uint32(rt) << 16) | (uint32(rd) << 11) | (uint32(shamt&0x1f) << 6) | instr.Funct
+		word |= (uint32(rt) << 16) | (uint32(rd) << 11) | (c.field(toks[3], shamt, 5, "shamt") << 6)
 	// Format: op rs
-	case "jr", "mthi", "mtlo":
+	case isa.SynRs:
 		if len(toks) < 2 {
-			return nil, fmt.Errorf("line %d: %s 需要 1 个寄存器操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 1 个寄存器操作数", op)
 		}
-		rs := regs.RegOf(toks[1], it.LineNo)
-		word = (uint32(rs) << 21) | instr.Funct
+		rs := rr.reg(toks[1])
+		word |= uint32(rs) << 21
 	// Format: op rd
-	case "mfhi", "mflo":
+	case isa.SynRd:
 		if len(toks) < 2 {
-			return nil, fmt.Errorf("line %d: %s 需要 1 个寄存器操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 1 个寄存器操作数", op)
 		}
-		rd := regs.RegOf(toks[1], it.LineNo)
-		word = (uint32(rd) << 11) | instr.Funct
+		rd := rr.reg(toks[1])
+		word |= uint32(rd) << 11
 	// Format: op rs, rt
-	case "mult", "multu", "div", "divu":
+	case isa.SynRsRt:
 		if len(toks) < 3 {
-			return nil, fmt.Errorf("line %d: %s 需要 2 个寄存器操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 2 个寄存器操作数", op)
 		}
-		rs := regs.RegOf(toks[1], it.LineNo)
-		rt := regs.RegOf(toks[2], it.LineNo)
-		word = (uint32(rs) << 21) | (uint32(rt) << 16) | instr.Funct
+		rs := rr.reg(toks[1])
+		rt := rr.reg(toks[2])
+		word |= (uint32(rs) << 21) | (uint32(rt) << 16)
 	// Format: op rd, rs
-	case "jalr":
+	case isa.SynRdRs:
+		if len(toks) < 3 {
+			return nil, fmt.Errorf("%s 需要 2 个寄存器操作数", op)
+		}
+		rd := rr.reg(toks[1])
+		rs := rr.reg(toks[2])
+		word |= (uint32(rs) << 21) | (uint32(rd) << 11)
+	// Format: op rt, rd（rd 为协处理器 0 的寄存器号）
+	case isa.SynRtCop:
+		if len(toks) < 3 {
+			return nil, fmt.Errorf("%s 需要 2 个寄存器操作数", op)
+		}
+		rt := rr.reg(toks[1])
+		rd := rr.reg(toks[2])
+		word |= (uint32(rt) << 16) | (uint32(rd) << 11)
+	// Format: jalr rd, rs
+	case isa.SynJalr:
 		if len(toks) < 2 { // 支持 jalr $rs 和 jalr $rd, $rs 两种格式
-			return nil, fmt.Errorf("line %d: %s 至少需要一个操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 至少需要一个操作数", op)
 		}
 		var rd, rs int
 		if len(toks) == 2 { // jalr $rs -> $ra is implicitly $rd (31)
 			rd = 31
-			rs = regs.RegOf(toks[1], it.LineNo)
+			rs = rr.reg(toks[1])
 		} else { // jalr $rd, $rs
-			rd = regs.RegOf(toks[1], it.LineNo)
-			rs = regs.RegOf(toks[2], it.LineNo)
+			rd = rr.reg(toks[1])
+			rs = rr.reg(toks[2])
+		}
+		word |= (uint32(rs) << 21) | (uint32(rd) << 11)
+	// Format: break [code]
+	case isa.SynCode:
+		var code uint32
+		if len(toks) >= 2 {
+			v, err := parseNumber(toks[1], nil)
+			if err != nil {
+				return nil, diag.Tok(toks[1], fmt.Errorf("%s code 解析失败: %v", op, err))
+			}
+			code = c.field(toks[1], v, 20, op+" code")
 		}
-		word = (uint32(rs) << 21) | (uint32(rd) << 11) | instr.Funct
+		word |= code << 6
 	default:
-		return nil, fmt.Errorf("line %d: 不支持的R类型指令: %s", it.LineNo, op)
+		return nil, fmt.Errorf("不支持的R类型指令: %s", op)
+	}
+	if rr.err != nil {
+		return nil, rr.err
 	}
 	return []uint32{word}, nil
 }
 
-func assembleIType(it types.Item, instr types.Instruction, labels map[string]uint32, addr uint32, base uint32) ([]uint32, error) {
+// assembleIType 汇编带 16 位立即数、访存偏移或分支目标的指令
+func assembleIType(it types.Item, spec *isa.Spec, labels map[string]uint32, addr uint32, base uint32, c *checker) ([]uint32, error) {
 	toks := it.Tokens
-	op := strings.ToLower(toks[0])
-	var word uint32
+	op := spec.Name
+	word := spec.Match
+	var rr regReader
+
+	// imm 求值立即数操作数并按指令的立即数类别检查范围
+	imm := func(tok string) (uint32, error) {
+		v, err := parseNumber(tok, labels)
+		if err != nil {
+			return 0, diag.Tok(tok, fmt.Errorf("解析立即数失败: %v", err))
+		}
+		if err := c.imm(tok); err != nil {
+			return 0, diag.Tok(tok, err)
+		}
+		switch spec.Imm {
+		case isa.ImmUnsigned:
+			return c.unsigned(tok, v, "立即数"), nil
+		case isa.ImmUpper:
+			// 高 16 位既可按无符号写，也可写成负数
+			if v > 0xffff && int32(v) < -0x8000 {
+				c.report(tok, "%s 立即数 0x%x 超出 16 位范围", op, v)
+			}
+			return v & 0xffff, nil
+		}
+		return c.signed(tok, v, "立即数"), nil
+	}
 
-	switch op {
+	switch spec.Syntax {
 	// Format: op rt, rs, imm
-	case "addi", "addiu", "andi", "ori", "xori", "slti", "sltiu":
+	case isa.SynRtRsImm:
 		if len(toks) < 4 {
-			return nil, fmt.Errorf("line %d: %s 需要 3 个操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 3 个操作数", op)
 		}
-		rt := regs.RegOf(toks[1], it.LineNo)
-		rs := regs.RegOf(toks[2], it.LineNo)
-		imm, err := parseNumber(toks[3], labels, base)
+		rt := rr.reg(toks[1])
+		rs := rr.reg(toks[2])
+		v, err := imm(toks[3])
 		if err != nil {
-			return nil, fmt.Errorf("line %d: 解析立即数失败: %v", it.LineNo, err)
+			return nil, err
 		}
-		word = (instr.Opcode << 26) | (uint32(rs) << 21) | (uint32(rt) << 16) | (uint32(imm) & 0xffff)
+		word |= (uint32(rs) << 21) | (uint32(rt) << 16) | v
 	// Format: op rt, imm
-	case "lui":
+	case isa.SynRtImm:
 		if len(toks) < 3 {
-			return nil, fmt.Errorf("line %d: lui 需要 reg, imm", it.LineNo)
+			return nil, fmt.Errorf("%s 需要 reg, imm", op)
 		}
-		rt := regs.RegOf(toks[1], it.LineNo)
-		imm, err := parseNumber(toks[2], labels, base)
+		rt := rr.reg(toks[1])
+		v, err := imm(toks[2])
 		if err != nil {
-			return nil, fmt.Errorf("line %d: lui 立即数解析失败: %v", it.LineNo, err)
+			return nil, err
 		}
-		word = (instr.Opcode << 26) | (uint32(rt) << 16) | (imm & 0xffff)
+		word |= (uint32(rt) << 16) | v
+	// Format: op rs, imm
+	case isa.SynRsImm:
+		if len(toks) < 3 {
+			return nil, fmt.Errorf("%s 需要 2 个操作数", op)
+		}
+		rs := rr.reg(toks[1])
+		v, err := imm(toks[2])
+		if err != nil {
+			return nil, err
+		}
+		word |= (uint32(rs) << 21) | v
 	// Format: op rt, offset(base)
-	case "lw", "lh", "lhu", "lb", "lbu", "sw", "sh", "sb":
+	case isa.SynMem:
 		if len(toks) < 3 {
-			return nil, fmt.Errorf("line %d: %s 需要 2 个操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 2 个操作数", op)
 		}
-		rt := regs.RegOf(toks[1], it.LineNo)
-		off, baseReg, err := parseOffsetBase(toks[2], labels, base)
+		rt := rr.reg(toks[1])
+		off, baseReg, err := parseOffsetBase(toks[2], labels)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: 解析 offset(base) 失败: %v", it.LineNo, err)
+			return nil, diag.Tok(toks[2], fmt.Errorf("解析 offset(base) 失败: %v", err))
+		}
+		if err := c.imm(toks[2][:strings.LastIndex(toks[2], "(")]); err != nil {
+			return nil, diag.Tok(toks[2], err)
+		}
+		// 基址为 $zero 时地址即偏移，可检查对齐
+		if baseReg == 0 {
+			c.aligned(toks[2], uint32(off), spec.Access, op+" 地址")
 		}
-		word = (instr.Opcode << 26) | (uint32(baseReg) << 21) | (uint32(rt) << 16) | (uint32(off) & 0xffff)
+		word |= (uint32(baseReg) << 21) | (uint32(rt) << 16) | c.signed(toks[2], uint32(off), "偏移")
 	// Format: op rs, rt, label
-	case "beq", "bne":
+	case isa.SynRsRtBranch:
 		if len(toks) < 4 {
-			return nil, fmt.Errorf("line %d: %s 需要 3 个操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 3 个操作数", op)
 		}
-		rs := regs.RegOf(toks[1], it.LineNo)
-		rt := regs.RegOf(toks[2], it.LineNo)
-		off, err := branchOffset(toks[3], labels, addr, base)
+		rs := rr.reg(toks[1])
+		rt := rr.reg(toks[2])
+		off, err := branchOffset(toks[3], labels, addr, base, c)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: 分支目标解析失败: %v", it.LineNo, err)
+			return nil, diag.Tok(toks[3], fmt.Errorf("分支目标解析失败: %v", err))
 		}
-		word = (instr.Opcode << 26) | (uint32(rs) << 21) | (uint32(rt) << 16) | (uint32(off) & 0xffff)
+		word |= (uint32(rs) << 21) | (uint32(rt) << 16) | off
 	// Format: op rs, label
-	case "blez", "bgtz":
+	case isa.SynRsBranch:
 		if len(toks) < 3 {
-			return nil, fmt.Errorf("line %d: %s 需要 2 个操作数", it.LineNo, op)
+			return nil, fmt.Errorf("%s 需要 2 个操作数", op)
 		}
-		rs := regs.RegOf(toks[1], it.LineNo)
-		off, err := branchOffset(toks[2], labels, addr, base)
+		rs := rr.reg(toks[1])
+		off, err := branchOffset(toks[2], labels, addr, base, c)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: 分支目标解析失败: %v", it.LineNo, err)
+			return nil, diag.Tok(toks[2], fmt.Errorf("分支目标解析失败: %v", err))
 		}
-		word = (instr.Opcode << 26) | (uint32(rs) << 21) | (uint32(off) & 0xffff)
+		word |= (uint32(rs) << 21) | off
 	default:
-		return nil, fmt.Errorf("line %d: 不支持的I类型指令: %s", it.LineNo, op)
+		return nil, fmt.Errorf("不支持的I类型指令: %s", op)
+	}
+	if rr.err != nil {
+		return nil, rr.err
 	}
 	return []uint32{word}, nil
 }
 
-func assembleJType(it types.Item, instr types.Instruction, labels map[string]uint32, base uint32) ([]uint32, error) {
+func assembleJType(it types.Item, spec *isa.Spec, labels map[string]uint32, addr uint32, base uint32, c *checker) ([]uint32, error) {
 	toks := it.Tokens
 	if len(toks) < 2 {
-		return nil, fmt.Errorf("line %d: %s 需要目标标签或地址", it.LineNo, toks[0])
+		return nil, fmt.Errorf("%s 需要目标标签或地址", toks[0])
 	}
 	targetTok := toks[1]
-	targetAddr, ok := labels[targetTok]
-	var targetAbs uint32
-	if ok {
-		targetAbs = base + targetAddr
-	} else {
-		v, err := parseNumber(targetTok, labels, base)
+	targetAbs, ok := labels[targetTok]
+	if !ok {
+		v, err := parseNumber(targetTok, labels)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: 未知跳转目标 %s", it.LineNo, targetTok)
+			return nil, diag.Tok(targetTok, fmt.Errorf("未知跳转目标 %s: %v", targetTok, err))
 		}
 		targetAbs = v
 	}
+	if err := c.jump(targetTok); err != nil {
+		return nil, diag.Tok(targetTok, err)
+	}
+	// 目标须与延迟槽（PC+4）位于同一 256MB 区域
+	c.aligned(targetTok, targetAbs, 4, "跳转目标")
+	if pc := base + addr + 4; (targetAbs^pc)&0xf0000000 != 0 {
+		c.report(targetTok, "跳转目标 0x%08x 与 PC+4 (0x%08x) 不在同一 256MB 区域", targetAbs, pc)
+	}
 	field := (targetAbs >> 2) & 0x03ffffff
-	word := (instr.Opcode << 26) | field
+	word := spec.Match | field
 	return []uint32{word}, nil
 }
 
-func assembleSpecial(it types.Item, labels map[string]uint32, base uint32) ([]uint32, error) {
-	toks := it.Tokens
-	op := strings.ToLower(toks[0])
+// regReader 依次解析寄存器操作数并记住第一个错误，免去逐个判断
+type regReader struct {
+	err error
+}
 
-	switch op {
-	case "nop":
-		return []uint32{0x00000000}, nil
-	case "li":
-		// li rd, imm  --> lui at, imm>>16 ; ori rd, at, imm&0xFFFF
-		if len(toks) < 3 {
-			return nil, fmt.Errorf("line %d: li 需要两个操作数", it.LineNo)
-		}
-		rd := regs.RegOf(toks[1], it.LineNo)
-		imm32, err := parseNumber(toks[2], labels, base)
-		if err != nil {
-			return nil, fmt.Errorf("line %d: li 立即数解析失败: %v", it.LineNo, err)
-		}
-		hi := (imm32 >> 16) & 0xffff
-		lo := imm32 & 0xffff
-		// lui at, hi
-		lui := (instrTable["lui"].Opcode << 26) | (uint32(1) << 16) | hi
-		// ori rd, at, lo
-		ori := (instrTable["ori"].Opcode << 26) | (uint32(1) << 21) | (uint32(rd) << 16) | lo
-		return []uint32{lui, ori}, nil
+func (r *regReader) reg(tok string) int {
+	n, err := regs.RegOf(tok)
+	if err != nil && r.err == nil {
+		r.err = err
 	}
-	return nil, fmt.Errorf("line %d: 未知特殊指令 %s", it.LineNo, op)
+	return n
 }
 
-func parseNumber(s string, labels map[string]uint32, base uint32) (uint32, error) {
-	s = strings.TrimSpace(s)
-	if v, ok := labels[s]; ok {
-		return base + v, nil
-	}
-	// hex
-	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
-		v, err := strconv.ParseUint(s[2:], 16, 32)
-		return uint32(v), err
-	}
-	// negative?
-	if strings.HasPrefix(s, "-") {
-		v, err := strconv.ParseInt(s, 10, 32)
-		return uint32(v), err
-	}
-	// decimal
-	v, err := strconv.ParseUint(s, 10, 32)
-	return uint32(v), err
+// parseNumber 计算立即数或符号表达式，见 expr.Eval
+func parseNumber(s string, labels map[string]uint32) (uint32, error) {
+	return expr.Eval(strings.TrimSpace(s), lookup(labels))
 }
 
-func parseOffsetBase(s string, labels map[string]uint32, base uint32) (int32, int, error) {
-	// 期望形如: 4($t0) 或 label($t0)
+func parseOffsetBase(s string, labels map[string]uint32) (int32, int, error) {
+	// 期望形如: 4($t0)、label($t0) 或 (END-START)/4($t0)，偏移可为任意表达式
 	s = strings.TrimSpace(s)
-	if i := strings.Index(s, "("); i >= 0 {
-		j := strings.Index(s, ")")
-		if j < 0 {
-			return 0, 0, fmt.Errorf("缺少右括号")
-		}
-		offStr := strings.TrimSpace(s[:i])
-		baseStr := strings.TrimSpace(s[i+1 : j])
-		baseReg := regs.RegOf(baseStr, 0)
-		if offStr == "" {
-			return 0, baseReg, nil
-		}
-		if v, ok := labels[offStr]; ok {
-			return int32(base + v), baseReg, nil
-		}
-		// 支持 0x.. 或 十进制或负数
-		if strings.HasPrefix(offStr, "0x") || strings.HasPrefix(offStr, "0X") {
-			val, err := strconv.ParseInt(offStr[2:], 16, 32)
-			return int32(val), baseReg, err
-		}
-		val, err := strconv.ParseInt(offStr, 10, 32)
-		return int32(val), baseReg, err
+	if strings.HasSuffix(s, ")") {
+		if i := strings.LastIndex(s, "("); i >= 0 {
+			offStr := strings.TrimSpace(s[:i])
+			baseStr := strings.TrimSpace(s[i+1 : len(s)-1])
+			baseReg, err := regs.RegOf(baseStr)
+			if err != nil {
+				return 0, 0, err
+			}
+			if offStr == "" {
+				return 0, baseReg, nil
+			}
+			v, err := parseNumber(offStr, labels)
+			return int32(v), baseReg, err
+		}
 	}
 	return 0, 0, fmt.Errorf("offset(base) 形式期望，但收到: %s", s)
 }
 
-func branchOffset(target string, labels map[string]uint32, curAddr uint32, base uint32) (int32, error) {
+// branchOffset 计算分支偏移的 16 位编码。常数表达式为以字计的偏移，
+// 引用符号时为目标地址。
+func branchOffset(target string, labels map[string]uint32, curAddr uint32, base uint32, c *checker) (uint32, error) {
+	// 不含符号的常数表达式直接作为偏移
+	if v, err := parseNumber(target, nil); err == nil {
+		return c.signed(target, v, "分支偏移"), nil
+	}
 	// offset = (labelAddr - (curAddr + 4)) / 4
-	target = strings.TrimSpace(target)
-	if v, ok := labels[target]; ok {
-		curAbs := int32(base + curAddr)
-		targetAbs := int32(base + v)
-		offset := targetAbs - (curAbs + 4)
-		return offset / 4, nil
+	v, err := parseNumber(target, labels)
+	if err != nil {
+		return 0, fmt.Errorf("未知分支目标 %s: %v", strings.TrimSpace(target), err)
 	}
-	// numeric
-	if strings.HasPrefix(target, "0x") || strings.HasPrefix(target, "0X") {
-		val, err := strconv.ParseInt(target[2:], 16, 16)
-		return int32(val), err
+	// 目标在其他文件中时由链接器填写偏移
+	if relocated, err := c.branch(target); err != nil || relocated {
+		return 0, err
 	}
-	val, err := strconv.ParseInt(target, 10, 32)
-	if err == nil {
-		return int32(val), nil
+	c.aligned(target, v, 4, "分支目标")
+	curAbs := int64(base + curAddr)
+	offset := (int64(v) - (curAbs + 4)) >> 2
+	if offset < -0x8000 || offset > 0x7fff {
+		c.report(target, "分支目标 0x%x 超出分支范围（偏移 %d 条指令，范围 [-32768, 32767]）", v, offset)
 	}
-	return 0, fmt.Errorf("未知分支目标: %s", target)
+	return uint32(offset) & 0xffff, nil
 }
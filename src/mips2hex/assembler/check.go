@@ -0,0 +1,90 @@
+package assembler
+
+import (
+	"fmt"
+
+	"mips2hex/diag"
+)
+
+// CheckMode 决定立即数与 .half/.byte 数据越界、分支超出范围、跳转跨 256MB 区域与未对齐访问的处理方式。
+// 不论哪种方式，编码时都按字段宽度截断。
+type CheckMode int
+
+const (
+	CheckOff    CheckMode = iota // 不检查（旧行为）
+	CheckWarn                    // 报告为警告，继续汇编
+	CheckStrict                  // 报告为错误
+)
+
+// checker 收集一条 item 汇编过程中发现的问题，由调用方按 CheckMode 转换为诊断；
+// 生成目标文件时还收集需要重定位的字段（见 object.go）
+type checker struct {
+	problems []error
+	rel      *relocator // 生成目标文件时非空
+	word     int        // 当前指令在 item 展开结果中的序号
+	fixups   []fixup
+}
+
+func (c *checker) report(tok string, format string, args ...any) {
+	if c == nil {
+		return
+	}
+	c.problems = append(c.problems, diag.Tok(tok, fmt.Errorf(format, args...)))
+}
+
+// signed 检查 v 能否表示为有符号 16 位立即数，返回低 16 位
+func (c *checker) signed(tok string, v uint32, what string) uint32 {
+	if s := int32(v); s < -0x8000 || s > 0x7fff {
+		c.report(tok, "%s %d 超出有符号 16 位范围 [-32768, 32767]", what, s)
+	}
+	return v & 0xffff
+}
+
+// unsigned 检查 v 能否表示为无符号 16 位立即数，返回低 16 位
+func (c *checker) unsigned(tok string, v uint32, what string) uint32 {
+	if v > 0xffff {
+		c.report(tok, "%s 0x%x 超出无符号 16 位范围 [0, 0xffff]", what, v)
+	}
+	return v & 0xffff
+}
+
+// field 检查 v 能否放入 bits 位的无符号字段，返回截断后的值
+func (c *checker) field(tok string, v uint32, bits uint, what string) uint32 {
+	max := uint32(1)<<bits - 1
+	if v > max {
+		c.report(tok, "%s %d 超出范围 [0, %d]", what, int32(v), max)
+	}
+	return v & max
+}
+
+// datum 检查 v 能否作为有符号或无符号数放入 bits 位的数据，返回截断后的值
+func (c *checker) datum(tok string, v uint32, bits uint, what string) uint32 {
+	max := uint32(1)<<bits - 1
+	if s, min := int32(v), -int32(1)<<(bits-1); v > max && (s >= 0 || s < min) {
+		c.report(tok, "%s %d 超出 %d 位范围 [%d, %d]", what, s, bits, min, max)
+	}
+	return v & max
+}
+
+// aligned 检查地址 v 是否按 n 字节对齐
+func (c *checker) aligned(tok string, v uint32, n uint32, what string) {
+	if v%n != 0 {
+		c.report(tok, "%s 0x%x 未按 %d 字节对齐", what, v, n)
+	}
+}
+
+// diags 把收集到的问题转换为 mode 对应级别的诊断
+func (c *checker) diags(mode CheckMode, wrap func(diag.Severity, error) diag.Diagnostic) diag.List {
+	if mode == CheckOff {
+		return nil
+	}
+	sev := diag.Warning
+	if mode == CheckStrict {
+		sev = diag.Error
+	}
+	var out diag.List
+	for _, p := range c.problems {
+		out = append(out, wrap(sev, p))
+	}
+	return out
+}
@@ -0,0 +1,147 @@
+package assembler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"mips2hex/diag"
+)
+
+// WriteObject 以 JSON 写出目标文件
+func WriteObject(w io.Writer, obj *Object) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(obj)
+}
+
+// ReadObject 读取 WriteObject 写出的目标文件
+func ReadObject(r io.Reader) (*Object, error) {
+	var obj Object
+	if err := json.NewDecoder(r).Decode(&obj); err != nil {
+		return nil, fmt.Errorf("目标文件格式错误: %v", err)
+	}
+	return &obj, nil
+}
+
+// Link 按给定顺序把各目标文件的 .text 段依次放在 layout.TextBase 起、.data 段依次放在
+// layout.DataBase 起（各自按段内最大 .align 对齐），在全部文件的全局符号中解析外部符号
+// 并填写重定位，返回 .text 机器码与 .data 镜像。全局符号重复定义、外部符号未定义、
+// 跳转跨区或分支超出范围时报告错误。
+func Link(objs []*Object, layout Layout) ([]uint32, []uint32, error) {
+	var diags diag.List
+	fail := func(obj *Object, format string, args ...any) {
+		diags = append(diags, diag.Diagnostic{File: obj.Name, Severity: diag.Error, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// 布局：base[i] 为第 i 个文件各段的绝对地址
+	type bases struct{ text, data uint32 }
+	base := make([]bases, len(objs))
+	textEnd, dataEnd := layout.TextBase, layout.DataBase
+	for i, obj := range objs {
+		textEnd = alignUp(textEnd, obj.TextAlign)
+		dataEnd = alignUp(dataEnd, obj.DataAlign)
+		base[i] = bases{textEnd, dataEnd}
+		textEnd += uint32(len(obj.Text) * 4)
+		dataEnd += uint32(len(obj.Data) * 4)
+	}
+
+	globals := map[string]uint32{}
+	owner := map[string]*Object{}
+	for i, obj := range objs {
+		for _, s := range obj.Symbols {
+			if !s.Global {
+				continue
+			}
+			if prev, dup := owner[s.Name]; dup {
+				fail(obj, "全局符号 %s 重复定义（已在 %s 中定义）", s.Name, prev.Name)
+				continue
+			}
+			addr := base[i].text + s.Offset
+			if s.Section == ".data" {
+				addr = base[i].data + s.Offset
+			}
+			globals[s.Name], owner[s.Name] = addr, obj
+		}
+	}
+
+	text := make([]uint32, (textEnd-layout.TextBase)/4)
+	data := make([]uint32, (dataEnd-layout.DataBase)/4)
+	for i, obj := range objs {
+		t := text[(base[i].text-layout.TextBase)/4:]
+		d := data[(base[i].data-layout.DataBase)/4:]
+		copy(t, obj.Text)
+		copy(d, obj.Data)
+		for _, r := range obj.Relocs {
+			var s uint32
+			switch r.Symbol {
+			case ".text":
+				s = base[i].text
+			case ".data":
+				s = base[i].data
+			default:
+				v, ok := globals[r.Symbol]
+				if !ok {
+					fail(obj, "未定义的外部符号 %s", r.Symbol)
+					continue
+				}
+				s = v
+			}
+			seg, p := t, base[i].text+r.Offset
+			if r.Section == ".data" {
+				seg, p = d, base[i].data+r.Offset
+			}
+			idx := r.Offset / 4
+			if r.Offset%4 != 0 || int(idx) >= len(seg) {
+				fail(obj, "重定位偏移 0x%x 超出 %s 段", r.Offset, r.Section)
+				continue
+			}
+			w, err := relocate(seg[idx], r.Kind, s+r.Addend, p)
+			if err != nil {
+				fail(obj, "%s+0x%x 处引用 %s: %v", r.Section, r.Offset, r.Symbol, err)
+				continue
+			}
+			seg[idx] = w
+		}
+	}
+	if err := diags.Err(); err != nil {
+		return nil, nil, err
+	}
+	return text, data, nil
+}
+
+// relocate 把目标地址 v 按 kind 写入位于地址 p 的字 w
+func relocate(w uint32, kind RelocKind, v, p uint32) (uint32, error) {
+	switch kind {
+	case Reloc32:
+		return v, nil
+	case Reloc26:
+		if v%4 != 0 {
+			return 0, fmt.Errorf("跳转目标 0x%08x 未按 4 字节对齐", v)
+		}
+		if (v^(p+4))&0xf0000000 != 0 {
+			return 0, fmt.Errorf("跳转目标 0x%08x 与 PC+4 (0x%08x) 不在同一 256MB 区域", v, p+4)
+		}
+		return w&^0x03ffffff | (v>>2)&0x03ffffff, nil
+	case RelocPC16:
+		off := (int64(v) - int64(p) - 4) >> 2
+		if v%4 != 0 || off < -0x8000 || off > 0x7fff {
+			return 0, fmt.Errorf("分支目标 0x%08x 超出分支范围或未对齐", v)
+		}
+		return w&^0xffff | uint32(off)&0xffff, nil
+	case RelocHI16:
+		return w&^0xffff | ((v+0x8000)>>16)&0xffff, nil
+	case RelocHI16U:
+		return w&^0xffff | v>>16, nil
+	case RelocLO16:
+		return w&^0xffff | v&0xffff, nil
+	}
+	return 0, fmt.Errorf("未知重定位类型 %s", kind)
+}
+
+func alignUp(v, n uint32) uint32 {
+	if n < 4 {
+		n = 4
+	}
+	return (v + n - 1) / n * n
+}
@@ -0,0 +1,70 @@
+package assembler
+
+import (
+	"sort"
+	"strings"
+
+	"mips2hex/diag"
+	"mips2hex/parser"
+	"mips2hex/types"
+)
+
+// Entry 是清单中的一项：.text 段的一个机器字，或 .data 段一个 item 的字节
+type Entry struct {
+	Seg   types.Segment
+	Addr  uint32 // 绝对地址
+	Word  uint32 // .text 段的机器字
+	Bytes []byte // .data 段的内容
+	Asm   string // 展开后的基本指令，伪指令的每条展开各占一项
+	Item  *types.Item
+	Index int // Item 在 items 中的下标，与 types.Symbol.Item 对应
+}
+
+// SymbolEntry 是符号表中的一项
+type SymbolEntry struct {
+	Name string
+	Seg  types.Segment
+	Addr uint32 // 绝对地址
+}
+
+// Listing 是汇编清单：按地址排列的机器码与来源，以及按地址排序的符号表
+type Listing struct {
+	Entries []Entry
+	Symbols []SymbolEntry
+}
+
+// AssembleListing 同 AssembleChecked，额外返回清单
+func AssembleListing(items []types.Item, labels map[string]types.Symbol, layout Layout, mode CheckMode) (*Listing, diag.List) {
+	lst := &Listing{}
+	_, _, diags := assemble(items, labels, layout, mode, lst, nil)
+	return lst, diags
+}
+
+// symbolTable 按地址（相同时按名字）排序符号
+func symbolTable(labels map[string]types.Symbol, abs map[string]uint32) []SymbolEntry {
+	out := make([]SymbolEntry, 0, len(labels))
+	for name, sym := range labels {
+		if sym.Extern || parser.IsLocal(name) {
+			continue
+		}
+		out = append(out, SymbolEntry{Name: name, Seg: sym.Seg, Addr: abs[name]})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Addr != out[j].Addr {
+			return out[i].Addr < out[j].Addr
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// formatInstr 把指令 token 还原为 "op a, b" 形式
+func formatInstr(toks []string) string {
+	if len(toks) == 0 {
+		return ""
+	}
+	if len(toks) == 1 {
+		return toks[0]
+	}
+	return toks[0] + " " + strings.Join(toks[1:], ", ")
+}
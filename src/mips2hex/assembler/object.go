@@ -0,0 +1,291 @@
+package assembler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"mips2hex/diag"
+	"mips2hex/expr"
+	"mips2hex/pseudo"
+	"mips2hex/types"
+)
+
+// RelocKind 是重定位的类型，决定链接时如何把 S+A（符号地址加addend）写入字段
+type RelocKind string
+
+const (
+	Reloc32    RelocKind = "32"    // .word：整个字为 S+A
+	Reloc26    RelocKind = "26"    // j/jal：低 26 位为 (S+A)>>2
+	RelocPC16  RelocKind = "pc16"  // 分支：低 16 位为 (S+A-(P+4))>>2，P 为指令地址
+	RelocHI16  RelocKind = "hi16"  // 进位修正的高 16 位，与符号扩展的 lo16 配合（%hi、lw label 的展开）
+	RelocHI16U RelocKind = "hi16u" // 不修正的高 16 位，与零扩展的 ori 配合（la 的展开）
+	RelocLO16  RelocKind = "lo16"  // 低 16 位（%lo）
+)
+
+// Reloc 是一条重定位。Symbol 为 .text/.data 时相对本文件的该段，否则为外部符号。
+type Reloc struct {
+	Section string    `json:"section"` // 被修改的字所在的段
+	Offset  uint32    `json:"offset"`  // 被修改的字在段内的偏移
+	Kind    RelocKind `json:"kind"`
+	Symbol  string    `json:"symbol"`
+	Addend  uint32    `json:"addend"`
+}
+
+// ObjSymbol 是目标文件中定义的符号
+type ObjSymbol struct {
+	Name    string `json:"name"`
+	Section string `json:"section"`
+	Offset  uint32 `json:"offset"`
+	Global  bool   `json:"global,omitempty"`
+}
+
+// Object 是可重定位目标文件：各段从 0 开始汇编，引用符号的字段由 Relocs 描述，
+// 链接时确定各段位置后填写。Text/Data 为大端序的字。
+type Object struct {
+	Name      string      `json:"name"`
+	Text      []uint32    `json:"text"`
+	Data      []uint32    `json:"data"`
+	TextAlign uint32      `json:"text_align"` // 段内 .align 要求的最大对齐，至少为 4
+	DataAlign uint32      `json:"data_align"`
+	Symbols   []ObjSymbol `json:"symbols"`
+	Relocs    []Reloc     `json:"relocs"`
+}
+
+// AssembleObject 把一个源文件汇编为可重定位目标文件。伪指令一律使用完整展开；
+// 未定义的符号须由 .extern 或 .globl 声明，引用它们以及本文件 .text/.data 中的地址的
+// j/jal、分支、%hi/%lo、la/lw label 等展开与 .word 生成重定位。
+// 同段内的分支是位置无关的，不生成重定位。
+func AssembleObject(name string, items []types.Item, labels map[string]types.Symbol, mode CheckMode) (*Object, diag.List) {
+	rel := &relocator{}
+	text, data, diags := assemble(items, labels, Layout{}, mode, nil, rel)
+	obj := &Object{Name: name, Text: text, Data: data, TextAlign: 4, DataAlign: 4, Relocs: rel.relocs}
+	for _, it := range rel.items {
+		if it.Seg == types.Text {
+			obj.TextAlign = max(obj.TextAlign, it.Align)
+		} else {
+			obj.DataAlign = max(obj.DataAlign, it.Align)
+		}
+	}
+	for name, sym := range rel.labels {
+		if !sym.Extern {
+			obj.Symbols = append(obj.Symbols, ObjSymbol{Name: name, Section: sectionName(sym.Seg), Offset: sym.Addr, Global: sym.Global})
+		}
+	}
+	sortSymbols(obj.Symbols)
+	return obj, diags
+}
+
+// sortSymbols 按段、偏移、名字排序，使目标文件内容稳定
+func sortSymbols(syms []ObjSymbol) {
+	sort.Slice(syms, func(i, j int) bool {
+		a, b := syms[i], syms[j]
+		if a.Section != b.Section {
+			return a.Section > b.Section // .text 在前
+		}
+		if a.Offset != b.Offset {
+			return a.Offset < b.Offset
+		}
+		return a.Name < b.Name
+	})
+}
+
+func sectionName(seg types.Segment) string {
+	if seg == types.Data {
+		return ".data"
+	}
+	return ".text"
+}
+
+// fixup 是一条 item 内待重定位的字段，word 为展开结果中的第几条指令
+type fixup struct {
+	word   int
+	kind   RelocKind
+	symbol string
+	addend uint32
+}
+
+// relocator 在生成目标文件时分析表达式依赖的符号并收集重定位
+type relocator struct {
+	items  []types.Item
+	labels map[string]types.Symbol
+	relocs []Reloc
+}
+
+// analyze 判断表达式 e 的值依赖哪个可重定位单元（本文件的 .text、.data 段或某个外部符号），
+// 返回单元名（与位置无关时为空）及单元地址取 0 时的值，即 addend。
+// 做法是把各单元的地址分别平移后重新求值：值随之平移的即为所依赖的单元，
+// 同段两个标签之差等与位置无关的表达式不受影响；其他变化（如 label*2）无法重定位。
+func (r *relocator) analyze(e string) (string, uint32, error) {
+	eval := func(shift string, seen map[string]bool) (uint32, error) {
+		return expr.Eval(strings.TrimSpace(e), func(name string) (uint32, bool) {
+			sym, ok := r.labels[name]
+			if !ok {
+				return 0, false
+			}
+			unit, v := name, uint32(0)
+			if !sym.Extern {
+				unit, v = sectionName(sym.Seg), sym.Addr
+			}
+			if seen != nil {
+				seen[unit] = true
+			}
+			if unit == shift {
+				v += 0x10000
+			}
+			return v, true
+		})
+	}
+	seen := map[string]bool{}
+	v, err := eval("", seen)
+	if err != nil {
+		return "", 0, err
+	}
+	unit := ""
+	for u := range seen {
+		w, err := eval(u, nil)
+		if err != nil {
+			return "", 0, err
+		}
+		switch int32(w - v) {
+		case 0:
+		case 0x10000:
+			if unit != "" {
+				return "", 0, fmt.Errorf("表达式 %s 同时依赖 %s 与 %s 的地址，无法重定位", e, unit, u)
+			}
+			unit = u
+		default:
+			return "", 0, fmt.Errorf("表达式 %s 无法重定位", e)
+		}
+	}
+	return unit, v, nil
+}
+
+var hiloRe = regexp.MustCompile(`^\s*%(hi|lo)\s*\((.*)\)\s*$`)
+
+// imm 处理 16 位立即数或偏移字段：引用地址时须写作 %hi(...)/%lo(...)
+func (c *checker) imm(e string) error {
+	if c.rel == nil || strings.TrimSpace(e) == "" {
+		return nil
+	}
+	kind := RelocKind("")
+	if m := hiloRe.FindStringSubmatch(e); m != nil && balanced(m[2]) {
+		kind, e = RelocLO16, m[2]
+		if m[1] == "hi" {
+			kind = RelocHI16
+		}
+	}
+	unit, v, err := c.rel.analyze(e)
+	if err != nil || unit == "" {
+		return err
+	}
+	if kind == "" {
+		return fmt.Errorf("16 位字段不能直接引用地址 %s，请使用 %%hi()/%%lo()", strings.TrimSpace(e))
+	}
+	c.fixups = append(c.fixups, fixup{word: c.word, kind: kind, symbol: unit, addend: v})
+	return nil
+}
+
+// balanced 报告 s 中的括号是否配对，用于确认 %hi(...) 的括号包住了整个表达式
+func balanced(s string) bool {
+	depth := 0
+	for _, ch := range s {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+// jump 为引用地址的 j/jal 目标记录重定位
+func (c *checker) jump(e string) error {
+	if c.rel == nil {
+		return nil
+	}
+	unit, v, err := c.rel.analyze(e)
+	if err != nil || unit == "" {
+		return err
+	}
+	c.fixups = append(c.fixups, fixup{word: c.word, kind: Reloc26, symbol: unit, addend: v})
+	return nil
+}
+
+// branch 为目标不在本文件 .text 段的分支记录重定位，返回是否已记录
+func (c *checker) branch(e string) (bool, error) {
+	if c.rel == nil {
+		return false, nil
+	}
+	unit, v, err := c.rel.analyze(e)
+	if err != nil || unit == "" || unit == ".text" {
+		return false, err
+	}
+	c.fixups = append(c.fixups, fixup{word: c.word, kind: RelocPC16, symbol: unit, addend: v})
+	return true, nil
+}
+
+// refs 为伪指令展开中取自标签地址的字段记录重定位
+func (c *checker) refs(refs []pseudo.Ref) error {
+	if c.rel == nil {
+		return nil
+	}
+	for _, r := range refs {
+		unit, v, err := c.rel.analyze(r.Expr)
+		if err != nil {
+			return err
+		}
+		if unit == "" {
+			continue
+		}
+		kind := RelocLO16
+		switch r.Code {
+		case "VH":
+			kind = RelocHI16
+		case "VHL":
+			kind = RelocHI16U
+		}
+		c.fixups = append(c.fixups, fixup{word: r.Line, kind: kind, symbol: unit, addend: v})
+	}
+	return nil
+}
+
+// add 把一条 .text item 的字段重定位加入结果，addr 为该 item 的段内偏移
+func (r *relocator) add(fixups []fixup, addr uint32) {
+	if r == nil {
+		return
+	}
+	for _, f := range fixups {
+		r.relocs = append(r.relocs, Reloc{Section: ".text", Offset: addr + uint32(f.word*4), Kind: f.kind, Symbol: f.symbol, Addend: f.addend})
+	}
+}
+
+// word 为引用地址的 .word 记录重定位
+func (r *relocator) word(seg types.Segment, addr uint32, e string) error {
+	unit, v, err := r.analyze(e)
+	if err != nil || unit == "" {
+		return err
+	}
+	r.relocs = append(r.relocs, Reloc{Section: sectionName(seg), Offset: addr, Kind: Reloc32, Symbol: unit, Addend: v})
+	return nil
+}
+
+// data 处理 .data 段的 .word/.half/.byte，只有 .word 可以引用地址
+func (r *relocator) data(it types.Item) error {
+	switch it.Kind {
+	case types.Word:
+		return r.word(types.Data, it.Addr, it.Raw)
+	case types.Half, types.Byte:
+		unit, _, err := r.analyze(it.Raw)
+		if err == nil && unit != "" {
+			err = fmt.Errorf("只有 .word 可以引用地址 %s", it.Raw)
+		}
+		return err
+	}
+	return nil
+}
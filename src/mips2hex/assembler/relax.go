@@ -0,0 +1,87 @@
+package assembler
+
+import (
+	"mips2hex/pseudo"
+	"mips2hex/types"
+)
+
+// relax 为伪指令选择最短展开。解析阶段在符号地址未知时按最短展开估计长度，
+// 这里在标签地址确定后重新选择写法（引用符号的表达式按值分类、标签地址超出
+// 16 位时放弃紧凑展开），长度增加时重算 .text 段地址与标签，直到不动点。
+// 长度只增不减，保证迭代终止。
+// 返回的 items 与 labels 均为副本，不修改调用方的数据。
+// reloc 为真时（生成目标文件）最终地址未知，一律不用紧凑展开。
+func relax(items []types.Item, labels map[string]types.Symbol, layout Layout, reloc bool) ([]types.Item, map[string]types.Symbol) {
+	items = append([]types.Item(nil), items...)
+	out := make(map[string]types.Symbol, len(labels))
+	for name, sym := range labels {
+		out[name] = sym
+	}
+
+	for {
+		layoutText(items, out)
+		abs := absLabels(out, layout)
+		eval := func(s string) (uint32, error) { return parseNumber(s, abs) }
+
+		changed := false
+		for i := range items {
+			it := &items[i]
+			if it.Seg != types.Text || it.Kind != types.Instr {
+				continue
+			}
+			f, ops := pseudo.Lookup(it.Tokens, lookup(abs))
+			if f == nil {
+				continue
+			}
+			fits, err := f.Fits(ops, eval)
+			if err != nil {
+				// 未定义标签等错误留给汇编时报告
+				fits = true
+			}
+			if reloc {
+				fits = false
+			}
+			if size := f.Size(fits); size > it.Size {
+				it.Size = size
+				changed = true
+			}
+		}
+		if !changed {
+			return items, out
+		}
+	}
+}
+
+// layoutText 按当前指令长度重算 .text 段各 item 的偏移、.align 填充与标签地址
+func layoutText(items []types.Item, labels map[string]types.Symbol) {
+	addr := uint32(0)
+	// next[i] 为下标不小于 i 的第一个 .text item 的偏移
+	next := make([]uint32, len(items)+1)
+	for i := range items {
+		it := &items[i]
+		if it.Seg != types.Text {
+			continue
+		}
+		if it.Align > 0 {
+			pad := (it.Align - addr%it.Align) % it.Align
+			it.Size = pad
+			it.Bytes = make([]byte, pad)
+		}
+		it.Addr = addr
+		addr += it.Size
+	}
+	next[len(items)] = addr
+	for i := len(items) - 1; i >= 0; i-- {
+		if items[i].Seg == types.Text {
+			next[i] = items[i].Addr
+		} else {
+			next[i] = next[i+1]
+		}
+	}
+	for name, sym := range labels {
+		if sym.Seg == types.Text && !sym.Extern && sym.Item <= len(items) {
+			sym.Addr = next[sym.Item]
+			labels[name] = sym
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package assembler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"mips2hex/diag"
+	"mips2hex/parser"
+	"mips2hex/types"
+)
+
+// Options 是 AssembleSource 的参数
+type Options struct {
+	File    string            // 源文件名，用于诊断与 .include 的相对路径，可为空
+	Layout  Layout            // 各段基址
+	Mode    CheckMode         // 范围与对齐检查方式
+	Defines map[string]string // 预定义符号，同命令行 -D
+}
+
+// SourceLine 是一条指令对应的源码行
+type SourceLine struct {
+	File string
+	Line int
+	Text string // 去掉首尾空白的源码
+}
+
+func (s SourceLine) String() string {
+	if s.File == "" {
+		return fmt.Sprintf("line %d: %s", s.Line, s.Text)
+	}
+	return fmt.Sprintf("%s:%d: %s", s.File, s.Line, s.Text)
+}
+
+// Program 是汇编结果：各段镜像、符号表、清单以及 PC 到源码行的映射
+type Program struct {
+	Layout  Layout
+	Text    []uint32
+	Data    []uint32
+	Symbols []SymbolEntry
+	Listing *Listing
+	Lines   map[uint32]SourceLine // .text 段每个机器字的地址到其源码行，伪指令的各条展开指向同一行
+}
+
+// Source 返回地址 pc 处指令的源码行
+func (p *Program) Source(pc uint32) (SourceLine, bool) {
+	s, ok := p.Lines[pc]
+	return s, ok
+}
+
+// AssembleSource 解析并汇编源码 src，是 mips2hex 与其他工具共用的入口。
+// 诊断包含解析与汇编阶段的全部错误和警告；存在错误时 Program 的内容不完整，
+// 源码无法解析时为 nil。
+func AssembleSource(src string, opts Options) (*Program, diag.List) {
+	items, labels, perr := parser.ParseSource(src, opts.File, opts.Defines)
+	return assembleProgram(items, labels, perr, opts)
+}
+
+// IsSource 判断 path 是否为汇编源文件（.s 或 .asm），供各工具区分源文件与机器码镜像
+func IsSource(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".s" || ext == ".asm"
+}
+
+// AssembleFile 读取并汇编 path，opts.File 被设为 path
+func AssembleFile(path string, opts Options) (*Program, diag.List) {
+	opts.File = path
+	items, labels, perr := parser.ParseFile(path, opts.Defines)
+	return assembleProgram(items, labels, perr, opts)
+}
+
+func assembleProgram(items []types.Item, labels map[string]types.Symbol, perr error, opts Options) (*Program, diag.List) {
+	if items == nil && perr != nil {
+		return nil, diag.AsList(perr)
+	}
+	lst := &Listing{}
+	text, data, diags := assemble(items, labels, opts.Layout, opts.Mode, lst, nil)
+	diags = append(diag.AsList(perr), diags...)
+	p := &Program{
+		Layout:  opts.Layout,
+		Text:    text,
+		Data:    data,
+		Symbols: lst.Symbols,
+		Listing: lst,
+		Lines:   map[uint32]SourceLine{},
+	}
+	for _, e := range lst.Entries {
+		if e.Seg == types.Text {
+			p.Lines[e.Addr] = sourceLine(e.Item)
+		}
+	}
+	return p, diags
+}
+
+// sourceLine 返回 item 的源码行；宏展开得到的指令指向最外层的调用处
+func sourceLine(it *types.Item) SourceLine {
+	s := SourceLine{File: it.File, Line: it.LineNo, Text: it.OrigLine}
+	for m := it.Macro; m != nil; m = m.Parent {
+		s = SourceLine{File: m.File, Line: m.LineNo, Text: m.Source}
+	}
+	s.Text = strings.TrimSpace(s.Text)
+	return s
+}
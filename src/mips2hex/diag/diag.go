@@ -0,0 +1,182 @@
+package diag
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Severity 是诊断的严重程度
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	}
+	return "error"
+}
+
+// Diagnostic 是一条带位置的诊断信息。Line/Col 从 1 开始，Col 为 0 表示未知列；
+// Source 为所在行原文，用于输出带 ^ 标记的源码摘录。
+type Diagnostic struct {
+	File     string
+	Line     int
+	Col      int
+	Severity Severity
+	Message  string
+	Source   string
+	Span     int          // 标记的宽度，0 视为 1
+	Notes    []Diagnostic // 附加说明，如宏展开的调用处
+}
+
+// Pos 返回 file:line:col 形式的位置；没有文件名时为 line N:col，没有行号时只有文件名
+func (d Diagnostic) Pos() string {
+	var b strings.Builder
+	if d.File != "" && d.Line == 0 {
+		// 不对应源码行的诊断，如链接错误
+		return d.File
+	}
+	if d.File != "" {
+		fmt.Fprintf(&b, "%s:%d", d.File, d.Line)
+	} else {
+		fmt.Fprintf(&b, "line %d", d.Line)
+	}
+	if d.Col > 0 {
+		fmt.Fprintf(&b, ":%d", d.Col)
+	}
+	return b.String()
+}
+
+// Error 返回单行形式，附加说明各占一行
+func (d Diagnostic) Error() string {
+	s := fmt.Sprintf("%s: %s: %s", d.Pos(), d.Severity, d.Message)
+	for _, n := range d.Notes {
+		s += "\n\t" + n.Error()
+	}
+	return s
+}
+
+// Format 以编译器风格写出诊断：位置、级别、信息，以及带 ^ 标记的源码摘录
+func (d Diagnostic) Format(w io.Writer) {
+	fmt.Fprintf(w, "%s: %s: %s\n", d.Pos(), d.Severity, d.Message)
+	if d.Source != "" {
+		src := strings.ReplaceAll(d.Source, "\t", " ")
+		fmt.Fprintf(w, "%5d | %s\n", d.Line, src)
+		if d.Col > 0 {
+			span := d.Span
+			if span < 1 {
+				span = 1
+			}
+			fmt.Fprintf(w, "      | %s^%s\n", strings.Repeat(" ", d.Col-1), strings.Repeat("~", span-1))
+		}
+	}
+	for _, n := range d.Notes {
+		n.Format(w)
+	}
+}
+
+// List 是一组诊断，实现 error 接口，便于在原有返回 error 的接口中携带多条诊断
+type List []Diagnostic
+
+func (l List) Error() string {
+	parts := make([]string, len(l))
+	for i, d := range l {
+		parts[i] = d.Error()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// HasErrors 报告是否存在 Error 级别的诊断
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// Err 在存在错误时返回 l 本身，否则返回 nil
+func (l List) Err() error {
+	if l.HasErrors() {
+		return l
+	}
+	return nil
+}
+
+// Print 按 Format 写出全部诊断，最后给出错误与警告数量
+func Print(w io.Writer, err error) {
+	l := AsList(err)
+	nerr, nwarn := 0, 0
+	for _, d := range l {
+		d.Format(w)
+		switch d.Severity {
+		case Error:
+			nerr++
+		case Warning:
+			nwarn++
+		}
+	}
+	if nerr+nwarn > 0 {
+		fmt.Fprintf(w, "%d 个错误, %d 个警告\n", nerr, nwarn)
+	}
+}
+
+// AsList 把 error 转换为诊断列表；非诊断错误转换为一条没有位置的错误
+func AsList(err error) List {
+	if err == nil {
+		return nil
+	}
+	var l List
+	if errors.As(err, &l) {
+		return l
+	}
+	var d Diagnostic
+	if errors.As(err, &d) {
+		return List{d}
+	}
+	return List{{Severity: Error, Message: err.Error()}}
+}
+
+// tokenError 记录出错的源码片段，用于定位列号
+type tokenError struct {
+	tok string
+	err error
+}
+
+func (e *tokenError) Error() string { return e.err.Error() }
+func (e *tokenError) Unwrap() error { return e.err }
+
+// Tok 为错误标注出错的源码片段；生成诊断时在源码行中查找该片段确定列号
+func Tok(tok string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &tokenError{tok: strings.TrimSpace(tok), err: err}
+}
+
+// Locate 在源码行 src 中查找 err 标注的片段，返回 1 起的列号与片段宽度；
+// 未标注或找不到时返回首个非空白字符的列号
+func Locate(src string, err error) (col, span int) {
+	var te *tokenError
+	if errors.As(err, &te) && te.tok != "" {
+		if i := strings.Index(src, te.tok); i >= 0 {
+			return i + 1, len(te.tok)
+		}
+	}
+	trimmed := strings.TrimLeft(src, " \t")
+	if trimmed == "" {
+		return 0, 0
+	}
+	return len(src) - len(trimmed) + 1, 0
+}
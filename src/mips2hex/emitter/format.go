@@ -0,0 +1,195 @@
+package emitter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Format 是一种内存镜像的输出格式。Write 把从地址 base 开始的字写入 w。
+type Format struct {
+	Name  string
+	Desc  string
+	Write func(w io.Writer, base uint32, words []uint32) error
+}
+
+var formats = map[string]Format{}
+
+// Register 注册输出格式，同名格式会被覆盖
+func Register(f Format) {
+	formats[f.Name] = f
+}
+
+// Lookup 按名字查找输出格式
+func Lookup(name string) (Format, bool) {
+	f, ok := formats[strings.ToLower(name)]
+	return f, ok
+}
+
+// Names 返回已注册格式的名字，按字母序
+func Names() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteFile 以名为 format 的格式把镜像写入 path
+func WriteFile(path, format string, base uint32, words []uint32) error {
+	f, ok := Lookup(format)
+	if !ok {
+		return fmt.Errorf("未知输出格式 %s（可选: %s）", format, strings.Join(Names(), ", "))
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	w := bufio.NewWriter(file)
+	if err := f.Write(w, base, words); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func init() {
+	Register(Format{Name: "hex", Desc: "每行一个 8 位十六进制字（默认）", Write: writeHex})
+	Register(Format{Name: "logisim", Desc: "Logisim v2.0 raw 镜像，连续相同的值写作 N*value", Write: writeLogisim})
+	Register(Format{Name: "readmemh", Desc: "Verilog $readmemh，以 @ 记录给出起始字地址", Write: writeReadmemh})
+	Register(Format{Name: "ihex", Desc: "Intel HEX，字节地址，大端序", Write: writeIHex})
+	Register(Format{Name: "bin-be", Desc: "大端序原始二进制", Write: binaryWriter(binary.BigEndian)})
+	Register(Format{Name: "bin-le", Desc: "小端序原始二进制", Write: binaryWriter(binary.LittleEndian)})
+	Register(Format{Name: "coe", Desc: "Xilinx COE 初始化文件", Write: writeCOE})
+	Register(Format{Name: "mif", Desc: "Altera/Intel MIF 初始化文件", Write: writeMIF})
+}
+
+func writeHex(w io.Writer, base uint32, words []uint32) error {
+	for _, v := range words {
+		if _, err := fmt.Fprintf(w, "%08x\n", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLogisim 按 Logisim 的 v2.0 raw 格式写出，每行 8 个值，
+// 连续 4 个及以上相同的值合并为 N*value
+func writeLogisim(w io.Writer, base uint32, words []uint32) error {
+	if _, err := fmt.Fprintln(w, "v2.0 raw"); err != nil {
+		return err
+	}
+	var fields []string
+	for i := 0; i < len(words); {
+		j := i
+		for j < len(words) && words[j] == words[i] {
+			j++
+		}
+		if n := j - i; n >= 4 {
+			fields = append(fields, fmt.Sprintf("%d*%x", n, words[i]))
+		} else {
+			for k := i; k < j; k++ {
+				fields = append(fields, fmt.Sprintf("%x", words[k]))
+			}
+		}
+		i = j
+	}
+	for i := 0; i < len(fields); i += 8 {
+		if _, err := fmt.Fprintln(w, strings.Join(fields[i:min(i+8, len(fields))], " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReadmemh 写出 $readmemh 文件，@ 后为以字计的起始地址
+func writeReadmemh(w io.Writer, base uint32, words []uint32) error {
+	if _, err := fmt.Fprintf(w, "@%08x\n", base/4); err != nil {
+		return err
+	}
+	return writeHex(w, base, words)
+}
+
+// writeIHex 写出 Intel HEX：每条数据记录 16 字节，地址超出 64KB 时
+// 以扩展线性地址记录（类型 04）给出高 16 位，最后是结束记录
+func writeIHex(w io.Writer, base uint32, words []uint32) error {
+	data := make([]byte, 0, len(words)*4)
+	for _, v := range words {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	record := func(typ byte, addr uint16, b []byte) error {
+		sum := byte(len(b)) + byte(addr>>8) + byte(addr) + typ
+		var sb strings.Builder
+		fmt.Fprintf(&sb, ":%02X%04X%02X", len(b), addr, typ)
+		for _, c := range b {
+			fmt.Fprintf(&sb, "%02X", c)
+			sum += c
+		}
+		_, err := fmt.Fprintf(w, "%s%02X\n", sb.String(), -sum)
+		return err
+	}
+	upper := uint32(0)
+	for i := 0; i < len(data); {
+		addr := base + uint32(i)
+		if hi := addr >> 16; hi != upper {
+			upper = hi
+			if err := record(0x04, 0, []byte{byte(hi >> 8), byte(hi)}); err != nil {
+				return err
+			}
+		}
+		// 一条记录不跨越 64KB 边界
+		n := min(16, len(data)-i, int(0x10000-addr&0xffff))
+		if err := record(0x00, uint16(addr), data[i:i+n]); err != nil {
+			return err
+		}
+		i += n
+	}
+	return record(0x01, 0, nil)
+}
+
+func binaryWriter(order binary.ByteOrder) func(io.Writer, uint32, []uint32) error {
+	return func(w io.Writer, base uint32, words []uint32) error {
+		return binary.Write(w, order, words)
+	}
+}
+
+// writeCOE 写出 Xilinx COE 文件，向量以逗号分隔、分号结尾
+func writeCOE(w io.Writer, base uint32, words []uint32) error {
+	if _, err := fmt.Fprint(w, "memory_initialization_radix=16;\nmemory_initialization_vector=\n"); err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		_, err := fmt.Fprintln(w, "0;")
+		return err
+	}
+	for i, v := range words {
+		sep := ","
+		if i == len(words)-1 {
+			sep = ";"
+		}
+		if _, err := fmt.Fprintf(w, "%08x%s\n", v, sep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMIF 写出 MIF 文件，地址为从 0 开始的字下标
+func writeMIF(w io.Writer, base uint32, words []uint32) error {
+	depth := max(len(words), 1)
+	if _, err := fmt.Fprintf(w, "DEPTH = %d;\nWIDTH = 32;\nADDRESS_RADIX = HEX;\nDATA_RADIX = HEX;\nCONTENT\nBEGIN\n", depth); err != nil {
+		return err
+	}
+	for i, v := range words {
+		if _, err := fmt.Fprintf(w, "%x : %08x;\n", i, v); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "END;")
+	return err
+}
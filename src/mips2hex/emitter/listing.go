@@ -0,0 +1,84 @@
+package emitter
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mips2hex/assembler"
+	"mips2hex/types"
+)
+
+// WriteListing 把汇编清单写入文件，见 FormatListing
+func WriteListing(path string, lst *assembler.Listing) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	FormatListing(w, lst)
+	return w.Flush()
+}
+
+// FormatListing 写出清单：每行为地址、机器码、展开后的指令与源码行号、源码，
+// 伪指令展开的后续各条不重复源码；.data 段每行至多 8 个字节；最后是符号表。
+// 来自 .include 文件的行以 文件名:行号 标出。
+func FormatListing(w io.Writer, lst *assembler.Listing) {
+	mainFile := ""
+	if len(lst.Entries) > 0 {
+		mainFile = lst.Entries[0].Item.File
+	}
+	var last *types.Item
+	line := func(format string, args ...any) {
+		fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf(format, args...), " "))
+	}
+	seg := types.Segment(-1)
+	for _, e := range lst.Entries {
+		if e.Seg != seg {
+			seg = e.Seg
+			fmt.Fprintf(w, "; %s\n", segName(seg))
+		}
+		src := ""
+		// 同一行产生的多个 item（如 .word 1, 2, 3）只标一次源码
+		if last == nil || e.Item.File != last.File || e.Item.LineNo != last.LineNo || e.Item.OrigLine != last.OrigLine {
+			last = e.Item
+			src = source(e.Item, mainFile)
+		}
+		if e.Seg == types.Text {
+			line("%08x  %08x  %-28s%s", e.Addr, e.Word, e.Asm, src)
+			continue
+		}
+		for i := 0; i < len(e.Bytes); i += 8 {
+			j := min(i+8, len(e.Bytes))
+			line("%08x  %-16s  %-20s%s", e.Addr+uint32(i), hex.EncodeToString(e.Bytes[i:j]), "", src)
+			src = ""
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "; 符号表")
+	for _, s := range lst.Symbols {
+		fmt.Fprintf(w, "%08x  %-5s  %s\n", s.Addr, segName(s.Seg), s.Name)
+	}
+}
+
+func segName(seg types.Segment) string {
+	if seg == types.Data {
+		return ".data"
+	}
+	return ".text"
+}
+
+// source 返回 "行号  源码"，非主文件的行带上文件名
+func source(it *types.Item, mainFile string) string {
+	pos := fmt.Sprint(it.LineNo)
+	if it.File != mainFile {
+		pos = filepath.Base(it.File) + ":" + pos
+	}
+	return fmt.Sprintf("%5s  %s", pos, strings.TrimSpace(it.OrigLine))
+}
@@ -0,0 +1,285 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"mips2hex/lexer"
+)
+
+// ErrUndefined 表示表达式引用了尚未定义的符号
+var ErrUndefined = errors.New("未定义的符号")
+
+// Eval 计算操作数表达式，结果按 32 位返回。
+//
+// 支持十进制/十六进制/二进制/八进制整数（见 lexer.ParseNumber）、字符字面量 'A' 与 '\n'、符号、括号，以及
+// 一元 - + ~ !、%hi()、%lo() 与二元 * / % + - << >> < <= > >= == != & ^ | && ||，
+// 优先级同 C，比较与逻辑运算的结果为 1 或 0。
+// %hi 为配合 %lo 使用的进位修正高 16 位，%lo 为符号扩展的低 16 位，
+// 即 lui $t0, %hi(sym) 后接 addiu/lw ..., %lo(sym)($t0) 可得到 sym。
+// 计算按 64 位有符号整数进行，最终结果须落在 [-2^31, 2^32-1] 内。
+// sym 为 nil 时任何符号都视为未定义。
+func Eval(s string, sym func(name string) (uint32, bool)) (uint32, error) {
+	toks, err := lexer.Lex(s)
+	if err != nil {
+		return 0, err
+	}
+	p := &parser{src: s, toks: toks, sym: sym}
+	p.next()
+	v, err := p.expr()
+	if err != nil {
+		return 0, err
+	}
+	if p.tok.kind != tEOF {
+		return 0, fmt.Errorf("表达式 %q 中多余的内容: %s", s, p.tok.text)
+	}
+	if v < -(1<<31) || v > 1<<32-1 {
+		return 0, fmt.Errorf("表达式 %q 的值 %d %w", s, v, lexer.ErrRange)
+	}
+	return uint32(v), nil
+}
+
+type tokKind int
+
+const (
+	tEOF tokKind = iota
+	tNum
+	tIdent
+	tOp
+	tErr
+)
+
+type token struct {
+	kind tokKind
+	text string
+	val  int64
+	err  error // kind 为 tErr 时的错误
+}
+
+type parser struct {
+	src  string
+	toks []lexer.Token
+	tok  token
+	sym  func(string) (uint32, bool)
+}
+
+func (p *parser) next() {
+	if len(p.toks) == 0 {
+		p.tok = token{kind: tEOF}
+		return
+	}
+	t := p.toks[0]
+	p.toks = p.toks[1:]
+	switch t.Kind {
+	case lexer.Number:
+		v, err := lexer.ParseNumber(t.Text)
+		if err != nil {
+			p.tok = token{kind: tErr, text: t.Text, err: err}
+			return
+		}
+		p.tok = token{kind: tNum, text: t.Text, val: v}
+	case lexer.Char:
+		p.tok = token{kind: tNum, text: t.Text, val: t.Val}
+	case lexer.Ident:
+		p.tok = token{kind: tIdent, text: t.Text}
+	default:
+		// %hi、%lo 由 % 与紧随其后的 hi、lo 组成
+		if t.Text == "%" && len(p.toks) > 0 && p.toks[0].Col == t.End()+1 &&
+			(p.toks[0].Text == "hi" || p.toks[0].Text == "lo") {
+			p.tok = token{kind: tOp, text: "%" + p.toks[0].Text}
+			p.toks = p.toks[1:]
+			return
+		}
+		p.tok = token{kind: tOp, text: t.Text}
+	}
+}
+
+// 二元运算符按优先级从低到高分层
+var levels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *parser) expr() (int64, error) {
+	return p.binary(0)
+}
+
+func (p *parser) binary(level int) (int64, error) {
+	if level == len(levels) {
+		return p.unary()
+	}
+	l, err := p.binary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for p.tok.kind == tOp && contains(levels[level], p.tok.text) {
+		op := p.tok.text
+		p.next()
+		r, err := p.binary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+		if l, err = apply(op, l, r); err != nil {
+			return 0, err
+		}
+	}
+	return l, nil
+}
+
+func contains(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func apply(op string, l, r int64) (int64, error) {
+	switch op {
+	case "||":
+		return truth(l != 0 || r != 0), nil
+	case "&&":
+		return truth(l != 0 && r != 0), nil
+	case "==":
+		return truth(l == r), nil
+	case "!=":
+		return truth(l != r), nil
+	case "<":
+		return truth(l < r), nil
+	case "<=":
+		return truth(l <= r), nil
+	case ">":
+		return truth(l > r), nil
+	case ">=":
+		return truth(l >= r), nil
+	case "|":
+		return l | r, nil
+	case "^":
+		return l ^ r, nil
+	case "&":
+		return l & r, nil
+	case "<<", ">>":
+		if r < 0 || r > 31 {
+			return 0, fmt.Errorf("移位位数 %d 超出 0..31", r)
+		}
+		if op == ">>" {
+			return l >> uint(r), nil
+		}
+		if v := l << uint(r); v>>uint(r) == l {
+			return v, nil
+		}
+	case "+":
+		if v := l + r; (v > l) == (r > 0) {
+			return v, nil
+		}
+	case "-":
+		if v := l - r; (v < l) == (r > 0) {
+			return v, nil
+		}
+	case "*":
+		if v := l * r; l == 0 || v/l == r && !(l == -1 && r == math.MinInt64) {
+			return v, nil
+		}
+	case "/", "%":
+		if r == 0 {
+			return 0, fmt.Errorf("除数为 0")
+		}
+		if op == "%" {
+			return l % r, nil
+		}
+		if l != math.MinInt64 || r != -1 {
+			return l / r, nil
+		}
+	default:
+		return 0, fmt.Errorf("未知运算符 %s", op)
+	}
+	// 中间结果超出 int64 时回绕，不能再与 32 位范围比较
+	return 0, fmt.Errorf("%d %s %d 溢出，%w", l, op, r, lexer.ErrRange)
+}
+func truth(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *parser) unary() (int64, error) {
+	if p.tok.kind == tOp {
+		switch op := p.tok.text; op {
+		case "-", "+", "~", "!":
+			p.next()
+			v, err := p.unary()
+			if err != nil {
+				return 0, err
+			}
+			switch op {
+			case "-":
+				return apply("-", 0, v)
+			case "~":
+				return int64(^uint32(v)), nil
+			case "!":
+				return truth(v == 0), nil
+			}
+			return v, nil
+		case "%hi", "%lo":
+			p.next()
+			if p.tok.kind != tOp || p.tok.text != "(" {
+				return 0, fmt.Errorf("%s 后缺少括号", op)
+			}
+			v, err := p.primary()
+			if err != nil {
+				return 0, err
+			}
+			if op == "%hi" {
+				return ((v + 0x8000) >> 16) & 0xffff, nil
+			}
+			return int64(int16(v & 0xffff)), nil
+		}
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (int64, error) {
+	t := p.tok
+	switch t.kind {
+	case tNum:
+		p.next()
+		return t.val, nil
+	case tIdent:
+		p.next()
+		if p.sym != nil {
+			if v, ok := p.sym(t.text); ok {
+				return int64(v), nil
+			}
+		}
+		return 0, fmt.Errorf("%w: %s", ErrUndefined, t.text)
+	case tOp:
+		if t.text == "(" {
+			p.next()
+			v, err := p.expr()
+			if err != nil {
+				return 0, err
+			}
+			if p.tok.kind != tOp || p.tok.text != ")" {
+				return 0, fmt.Errorf("表达式 %q 缺少右括号", p.src)
+			}
+			p.next()
+			return v, nil
+		}
+	case tErr:
+		return 0, t.err
+	case tEOF:
+		return 0, fmt.Errorf("表达式 %q 不完整", p.src)
+	}
+	return 0, fmt.Errorf("表达式 %q 中意外的 %s", p.src, t.text)
+}
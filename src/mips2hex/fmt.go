@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"mips2hex/asmfmt"
+)
+
+// runFmt 实现 mips2hex fmt：格式化源文件，默认输出到标准输出；没有给出文件时读标准输入
+func runFmt(args []string) {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	regStyle := fs.String("regs", "abi", "寄存器写法: abi($t0)、numeric($8) 或 keep(保持原样)")
+	commentCol := fs.Int("comment", asmfmt.DefaultCommentCol, "行尾注释的起始列")
+	write := fs.Bool("w", false, "把结果写回源文件，而不是输出到标准输出")
+	list := fs.Bool("l", false, "只列出格式与结果不同的文件")
+	fs.Parse(args)
+
+	style, err := asmfmt.ParseRegStyle(*regStyle)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	opts := asmfmt.Options{Regs: style, CommentCol: *commentCol}
+
+	if fs.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "用法: go run main.go fmt [-regs abi] [-w] [-l] code.s ...")
+			os.Exit(2)
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "读取标准输入失败:", err)
+			os.Exit(1)
+		}
+		fmt.Print(asmfmt.Source(string(src), opts))
+		return
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		out := asmfmt.Source(string(src), opts)
+		changed := out != string(src)
+		if *list && changed {
+			fmt.Println(path)
+		}
+		switch {
+		case *write && changed:
+			if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				failed = true
+			}
+		case !*write && !*list:
+			fmt.Print(out)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
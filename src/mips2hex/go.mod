@@ -1,3 +1,13 @@
 module mips2hex
 
 go 1.24.0
+
+require (
+	isa v0.0.0
+	memcfg v0.0.0
+)
+
+replace (
+	isa => ../isa
+	memcfg => ../memcfg
+)
@@ -0,0 +1,245 @@
+// Package lexer 把一行汇编源码切分为带列号的记号。
+// 字符串与字符字面量中的 #、逗号等不会被当作注释或分隔符。
+package lexer
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"mips2hex/diag"
+)
+
+// Kind 是记号的类别
+type Kind int
+
+const (
+	Ident    Kind = iota // 助记符、伪指令名、符号，以及局部标签引用 1f/1b
+	Register             // $t0、$8
+	Number               // 十进制、0x 十六进制、0b 二进制与 0 开头的八进制整数
+	String               // "..."
+	Char                 // 'a'
+	Punct                // 逗号、括号、冒号与运算符
+)
+
+var kindNames = [...]string{"ident", "register", "number", "string", "char", "punct"}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+// Token 是一个记号
+type Token struct {
+	Kind  Kind
+	Text  string // 源码原文，字面量含引号
+	Col   int    // 从 1 开始的列号（字节）
+	Val   int64  // Number 与 Char 的值；Number 超出 32 位时为 0
+	Bytes []byte // String 转义后的内容
+}
+
+// End 返回记号之后的字节偏移
+func (t Token) End() int {
+	return t.Col - 1 + len(t.Text)
+}
+
+// Lex 切分一行源码，遇到 # 或 // 注释即停止。
+// 错误以 diag.Tok 标注出错的片段。
+func Lex(line string) ([]Token, error) {
+	toks, _, err := scan(line)
+	return toks, err
+}
+
+// StripComment 删除 # 与 // 注释，字面量内的不计。
+// 行内有非法字面量时原样返回，由之后的 Lex 报告错误。
+func StripComment(line string) string {
+	_, end, err := scan(line)
+	if err != nil {
+		return line
+	}
+	return line[:end]
+}
+
+// twoCharOps 是由两个字符组成的运算符
+var twoCharOps = []string{"<<", ">>", "<=", ">=", "==", "!=", "&&", "||"}
+
+// scan 返回记号与代码部分的结束位置（注释起点或行尾）
+func scan(s string) ([]Token, int, error) {
+	var toks []Token
+	for i := 0; i < len(s); {
+		c := s[i]
+		start := i
+		tok := Token{Kind: Punct}
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f':
+			i++
+			continue
+		case c == '#' || strings.HasPrefix(s[i:], "//"):
+			return toks, i, nil
+		case c == '"':
+			b, n, err := unquote(s[i:])
+			if err != nil {
+				return nil, 0, err
+			}
+			tok.Kind, tok.Bytes = String, b
+			i += n
+		case c == '\'':
+			b, n, err := unquote(s[i:])
+			if err != nil {
+				return nil, 0, err
+			}
+			if len(b) != 1 {
+				return nil, 0, diag.Tok(s[i:i+n], fmt.Errorf("字符字面量 %s 须恰好包含一个字符", s[i:i+n]))
+			}
+			tok.Kind, tok.Val = Char, int64(b[0])
+			i += n
+		case c == '$':
+			i++
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			if i > start+1 {
+				tok.Kind = Register
+			}
+		case c >= '0' && c <= '9':
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			// 超出 32 位的数字仍是 Number，由使用者通过 ParseNumber 报告
+			text := s[start:i]
+			switch {
+			case numberRe.MatchString(text):
+				tok.Kind = Number
+				tok.Val, _ = ParseNumber(text)
+			case localRefRe.MatchString(text):
+				tok.Kind = Ident
+			default:
+				return nil, 0, diag.Tok(text, fmt.Errorf("非法的数字 %s", text))
+			}
+		case isIdentStart(c):
+			for i < len(s) && isIdentChar(s[i]) {
+				i++
+			}
+			tok.Kind = Ident
+		default:
+			_, n := utf8.DecodeRuneInString(s[i:])
+			i += n
+			for _, op := range twoCharOps {
+				if strings.HasPrefix(s[start:], op) {
+					i = start + len(op)
+				}
+			}
+		}
+		tok.Text, tok.Col = s[start:i], start+1
+		toks = append(toks, tok)
+	}
+	return toks, len(s), nil
+}
+
+var (
+	numberRe = regexp.MustCompile(`^(0[xX][0-9a-fA-F]+|0[bB][01]+|0[0-7]*|[1-9][0-9]*)$`)
+	// localRefRe 匹配数字局部标签的引用 1f、1b
+	localRefRe = regexp.MustCompile(`^[0-9]+[fb]$`)
+)
+
+// IsLocalRef 报告 t 是否为数字局部标签的引用
+func IsLocalRef(t Token) bool {
+	return t.Kind == Ident && localRefRe.MatchString(t.Text)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '$' || (c >= '0' && c <= '9')
+}
+
+// ErrRange 表示数字或表达式的值超出 32 位
+var ErrRange = errors.New("超出 32 位范围")
+
+// ParseNumber 解析整数字面量：十进制、0x 十六进制、0b 二进制、0 开头的八进制，不允许超过 32 位
+func ParseNumber(text string) (int64, error) {
+	digits, base := text, 10
+	switch {
+	case len(text) > 2 && (text[:2] == "0x" || text[:2] == "0X"):
+		digits, base = text[2:], 16
+	case len(text) > 2 && (text[:2] == "0b" || text[:2] == "0B"):
+		digits, base = text[2:], 2
+	case len(text) > 1 && text[0] == '0':
+		digits, base = text[1:], 8
+	}
+	v, err := strconv.ParseUint(digits, base, 32)
+	if errors.Is(err, strconv.ErrRange) {
+		return 0, fmt.Errorf("数字 %s %w", text, ErrRange)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("非法的数字 %s", text)
+	}
+	return int64(v), nil
+}
+
+var escapes = map[byte]byte{
+	'n': '\n', 't': '\t', 'r': '\r', 'a': '\a', 'b': '\b', 'f': '\f', 'v': '\v',
+	'\\': '\\', '"': '"', '\'': '\'',
+}
+
+// unquote 解析以 " 或 ' 开头的字面量，返回转义后的内容与消耗的字节数。
+// 支持 \n \t \r \a \b \f \v \\ \" \'、\xHH 与至多三位的八进制 \NNN（含 \0）。
+func unquote(s string) ([]byte, int, error) {
+	q := s[0]
+	var out []byte
+	for i := 1; i < len(s); {
+		c := s[i]
+		switch {
+		case c == q:
+			return out, i + 1, nil
+		case c != '\\':
+			out = append(out, c)
+			i++
+			continue
+		case i+1 >= len(s):
+			i++
+			continue
+		}
+		e := s[i+1]
+		switch {
+		case escapes[e] != 0:
+			out = append(out, escapes[e])
+			i += 2
+		case e >= '0' && e <= '7':
+			j := i + 1
+			for j < len(s) && j < i+4 && s[j] >= '0' && s[j] <= '7' {
+				j++
+			}
+			v, _ := strconv.ParseUint(s[i+1:j], 8, 16)
+			if v > 0xff {
+				return nil, 0, diag.Tok(s[i:j], fmt.Errorf("转义 %s 超出一个字节", s[i:j]))
+			}
+			out = append(out, byte(v))
+			i = j
+		case e == 'x':
+			j := i + 2
+			for j < len(s) && j < i+4 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			if j == i+2 {
+				return nil, 0, diag.Tok(s[i:j], fmt.Errorf("\\x 之后缺少十六进制数字"))
+			}
+			v, _ := strconv.ParseUint(s[i+2:j], 16, 8)
+			out = append(out, byte(v))
+			i = j
+		default:
+			return nil, 0, diag.Tok(s[i:i+2], fmt.Errorf("未知转义 \\%c", e))
+		}
+	}
+	if q == '"' {
+		return nil, 0, diag.Tok(s, fmt.Errorf("字符串缺少结束引号"))
+	}
+	return nil, 0, diag.Tok(s, fmt.Errorf("字符字面量缺少结束引号"))
+}
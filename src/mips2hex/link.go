@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"mips2hex/assembler"
+	"mips2hex/diag"
+	"mips2hex/parser"
+)
+
+// runLink 实现 mips2hex link：读取目标文件（.s 文件按 -D/-strict/-warn 先汇编为目标文件），
+// 按命令行顺序布局各段并解析符号，输出与直接汇编相同格式的镜像
+func runLink(args []string) {
+	fs := flag.NewFlagSet("link", flag.ExitOnError)
+	outPath := fs.String("output", "", "输出 hex 文件路径")
+	out := outputFlags(fs)
+	src := sourceFlags(fs)
+	fs.Parse(args)
+
+	if *outPath == "" || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "用法: go run main.go link -output instr.txt [-mem course] main.o lib.o handler.s ...")
+		os.Exit(2)
+	}
+	layout, err := out.layout(fs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var objs []*assembler.Object
+	var diags diag.List
+	for _, path := range fs.Args() {
+		obj, err := loadObject(path, src)
+		if err != nil {
+			diags = append(diags, diag.AsList(err)...)
+			continue
+		}
+		objs = append(objs, obj)
+	}
+	if !diags.HasErrors() {
+		words, data, err := assembler.Link(objs, layout)
+		if err == nil {
+			diag.Print(os.Stderr, diags)
+			out.write(*outPath, layout, words, data)
+			return
+		}
+		diags = append(diags, diag.AsList(err)...)
+	}
+	diag.Print(os.Stderr, diags)
+	os.Exit(1)
+}
+
+// loadObject 读取目标文件；以 .s/.asm 结尾的源文件按 src 直接汇编为目标文件
+func loadObject(path string, src *source) (*assembler.Object, error) {
+	if assembler.IsSource(path) {
+		items, labels, err := parser.ParseFile(path, src.defines)
+		if err != nil {
+			return nil, err
+		}
+		obj, diags := assembler.AssembleObject(path, items, labels, src.mode())
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		diag.Print(os.Stderr, diags)
+		return obj, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	obj, err := assembler.ReadObject(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return obj, nil
+}
+
+func writeObject(path string, obj *assembler.Object) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return assembler.WriteObject(f, obj)
+}
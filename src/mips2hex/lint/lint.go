@@ -0,0 +1,300 @@
+// Package lint 对解析后的程序做静态检查，报告可以汇编但多半有错的写法。
+// 检查基于汇编清单：每条语句（含伪指令的各条展开）的机器字经 isa.Decode 识别后，
+// 按字段得到读写的寄存器（isa.Spec.Use）与控制流。
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"isa"
+	"mips2hex/assembler"
+	"mips2hex/diag"
+	"mips2hex/lexer"
+	"mips2hex/parser"
+	"mips2hex/regs"
+	"mips2hex/types"
+)
+
+// 检查规则名，出现在 Finding.Rule 与 JSON 输出中
+const (
+	ZeroWrite   = "zero-write"   // 写入 $zero
+	AtUse       = "at-use"       // 与伪指令展开相邻处直接使用 $at
+	Unreachable = "unreachable"  // 无条件跳转之后没有标签的代码
+	UnusedLabel = "unused-label" // 从未引用的标签
+	UninitRead  = "uninit-read"  // 读取程序中从未写入的寄存器
+	Misaligned  = "misaligned"   // lw/sw 等的常量偏移未按访问宽度对齐
+	FallOff     = "fall-off"     // 执行越过 .text 末尾
+)
+
+// Finding 是一条检查结果
+type Finding struct {
+	Rule string
+	diag.Diagnostic
+}
+
+// 假定由运行环境初始化、读取前无需写入的寄存器：$zero、$gp、$sp
+var preset = map[uint32]bool{0: true, 28: true, 29: true}
+
+// stmt 是 .text 段中的一条语句及其机器字
+type stmt struct {
+	item   *types.Item
+	index  int
+	words  []uint32
+	pseudo bool // 展开为多条或不同的基本指令
+}
+
+// Check 汇编 items 并检查；汇编出错时返回汇编诊断，不做检查
+func Check(items []types.Item, labels map[string]types.Symbol, layout assembler.Layout) ([]Finding, diag.List) {
+	lst, diags := assembler.AssembleListing(items, labels, layout, assembler.CheckOff)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var code []*stmt
+	byIndex := map[int]*stmt{}
+	for _, e := range lst.Entries {
+		if e.Seg != types.Text || e.Item.Kind != types.Instr {
+			continue
+		}
+		s := byIndex[e.Index]
+		if s == nil {
+			s = &stmt{item: e.Item, index: e.Index}
+			byIndex[e.Index] = s
+			code = append(code, s)
+		}
+		s.words = append(s.words, e.Word)
+	}
+	for _, s := range code {
+		s.pseudo = len(s.words) > 1 || name(s.words[0]) != strings.ToLower(s.item.Tokens[0])
+	}
+	labeled := map[int]bool{}
+	for _, sym := range labels {
+		if !sym.Extern && sym.Seg == types.Text {
+			labeled[sym.Item] = true
+		}
+	}
+
+	c := &checker{}
+	c.registers(code)
+	c.atUse(code)
+	c.flow(code, labeled)
+	c.unusedLabels(items, labels)
+	sort.SliceStable(c.out, func(i, j int) bool {
+		a, b := c.out[i], c.out[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return c.out, nil
+}
+
+type checker struct {
+	out []Finding
+}
+
+func (c *checker) report(rule string, it types.Item, tok string, format string, args ...any) {
+	err := diag.Tok(tok, fmt.Errorf(format, args...))
+	c.out = append(c.out, Finding{Rule: rule, Diagnostic: it.Diag(diag.Warning, err)})
+}
+
+func name(w uint32) string {
+	if s := isa.Decode(w); s != nil {
+		return s.Name
+	}
+	return ""
+}
+
+// use 返回机器字读取与写入的通用寄存器
+func use(w uint32) (reads, writes []uint32) {
+	if s := isa.Decode(w); s != nil {
+		return s.Use(w)
+	}
+	return nil, nil
+}
+
+// registers 检查写入 $zero、读取从未写入的寄存器与未对齐的常量偏移
+func (c *checker) registers(code []*stmt) {
+	written := map[uint32]bool{}
+	for _, s := range code {
+		for _, w := range s.words {
+			_, ws := use(w)
+			for _, r := range ws {
+				written[r] = true
+			}
+		}
+	}
+	reported := map[uint32]bool{}
+	for _, s := range code {
+		zero, misaligned := false, false
+		for _, w := range s.words {
+			rs, ws := use(w)
+			for _, r := range ws {
+				if r == 0 && w != 0 && !zero {
+					zero = true
+					c.report(ZeroWrite, *s.item, operand(s.item, 0), "%s 写入 $zero，结果被丢弃", s.item.Tokens[0])
+				}
+			}
+			for _, r := range rs {
+				if !written[r] && !preset[r] && !reported[r] {
+					reported[r] = true
+					c.report(UninitRead, *s.item, isa.RegName(r), "读取的寄存器 %s 在程序中从未被写入", isa.RegName(r))
+				}
+			}
+			if spec := isa.Decode(w); spec != nil && spec.Access > 1 && !misaligned {
+				if off := int32(int16(w & 0xffff)); off%int32(spec.Access) != 0 {
+					misaligned = true
+					c.report(Misaligned, *s.item, operand(s.item, len(s.item.Tokens)-2), "%s 的偏移 %d 不是 %d 的倍数", spec.Name, off, spec.Access)
+				}
+			}
+		}
+	}
+}
+
+// operand 返回语句的第 i 个操作数，不存在时为空
+func operand(it *types.Item, i int) string {
+	if i < 0 || i+1 >= len(it.Tokens) {
+		return ""
+	}
+	return it.Tokens[i+1]
+}
+
+// atUse 检查源码中直接出现的 $at：汇编器展开伪指令时以 $at 为临时寄存器，
+// 与改写 $at 的伪指令相邻时其值会被破坏
+func (c *checker) atUse(code []*stmt) {
+	clobbers := func(s *stmt) bool {
+		if !s.pseudo {
+			return false
+		}
+		for _, w := range s.words {
+			if _, ws := use(w); len(ws) > 0 && ws[0] == 1 {
+				return true
+			}
+		}
+		return false
+	}
+	for i, s := range code {
+		at := atOperand(s.item)
+		if at == "" {
+			continue
+		}
+		for _, j := range []int{i - 1, i, i + 1} {
+			if j == i && at == operand(s.item, 0) {
+				// 伪指令以 $at 为目的寄存器时，展开对 $at 的改写即为其本意
+				continue
+			}
+			if j >= 0 && j < len(code) && clobbers(code[j]) {
+				c.report(AtUse, *s.item, at, "%s 是汇编器的临时寄存器，会被伪指令 %s 的展开改写", at, code[j].item.Tokens[0])
+				break
+			}
+		}
+	}
+}
+
+// atOperand 返回语句操作数中写作 $at 或 $1 的寄存器
+func atOperand(it *types.Item) string {
+	for _, op := range it.Tokens[1:] {
+		toks, _ := lexer.Lex(op)
+		for _, t := range toks {
+			if n, err := regs.RegOf(t.Text); t.Kind == lexer.Register && err == nil && n == 1 {
+				return t.Text
+			}
+		}
+	}
+	return ""
+}
+
+// uncond 报告机器字是否为不会顺序执行下一条的控制转移
+func uncond(w uint32) bool {
+	s := isa.Decode(w)
+	if s == nil {
+		return false
+	}
+	f := isa.Split(w)
+	switch s.Name {
+	case "j", "jr", "eret":
+		return true
+	case "beq":
+		return f.Rs == f.Rt
+	case "bgez", "blez":
+		return f.Rs == 0
+	}
+	return false
+}
+
+// flow 检查无条件跳转之后没有标签、无法到达的代码，以及执行越过 .text 末尾
+func (c *checker) flow(code []*stmt, labeled map[int]bool) {
+	dead := false // 当前语句无法顺序到达
+	for i, s := range code {
+		if labeled[s.index] {
+			dead = false
+		}
+		last := s.words[len(s.words)-1]
+		switch {
+		case dead:
+			// 同一段不可达代码只报告第一条
+		case i > 0 && !labeled[s.index] && uncond(code[i-1].words[len(code[i-1].words)-1]):
+			dead = true
+			c.report(Unreachable, *s.item, "", "无条件跳转之后的代码无法到达")
+		}
+		if i == len(code)-1 && !dead && !uncond(last) {
+			switch name(last) {
+			case "syscall", "break":
+			default:
+				c.report(FallOff, *s.item, "", "程序最后一条指令之后没有跳转或退出，执行会越过 .text 末尾")
+			}
+		}
+	}
+}
+
+// unusedLabels 检查从未被引用的标签；main、.globl 导出的标签与数字局部标签除外
+func (c *checker) unusedLabels(items []types.Item, labels map[string]types.Symbol) {
+	refs := map[string]bool{}
+	for _, it := range items {
+		for _, op := range it.Tokens {
+			toks, _ := lexer.Lex(op)
+			for _, t := range toks {
+				if t.Kind == lexer.Ident {
+					refs[t.Text] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sym := labels[name]
+		if sym.Extern || sym.Global || refs[name] || name == "main" || parser.IsLocal(name) {
+			continue
+		}
+		it := types.Item{File: sym.File, LineNo: sym.LineNo, OrigLine: sym.Source}
+		c.report(UnusedLabel, it, name, "标签 %s 从未被引用", name)
+	}
+}
+
+// WriteJSON 以 JSON Lines 写出检查结果，每行一个对象：
+// {"rule":...,"file":...,"line":...,"col":...,"severity":...,"message":...}
+func WriteJSON(w io.Writer, fs []Finding) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	for _, f := range fs {
+		err := enc.Encode(struct {
+			Rule     string `json:"rule"`
+			File     string `json:"file"`
+			Line     int    `json:"line"`
+			Col      int    `json:"col"`
+			Severity string `json:"severity"`
+			Message  string `json:"message"`
+		}{f.Rule, f.File, f.Line, f.Col, f.Severity.String(), f.Message})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -4,53 +4,239 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 
 	"mips2hex/assembler"
+	"mips2hex/diag"
 	"mips2hex/emitter"
+	"mips2hex/lint"
 	"mips2hex/parser"
+
+	"memcfg"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "link":
+			runLink(os.Args[2:])
+			return
+		case "fmt":
+			runFmt(os.Args[2:])
+			return
+		}
+	}
+
 	inPath := flag.String("input", "", "输入 MIPS asm 文件路径")
 	outPath := flag.String("output", "", "输出 hex 文件路径")
-	baseStr := flag.String("base", "0", ".text 段基址(0x前缀十六进制),用于分支/跳转计算")
+	objOut := flag.Bool("obj", false, "只汇编为可重定位目标文件，写到 -output，之后用 mips2hex link 链接")
+	out := outputFlags(flag.CommandLine)
+	listPath := flag.String("listing", "", "输出汇编清单(地址、机器码、展开后的指令、源码行)与符号表的路径")
+	src := sourceFlags(flag.CommandLine)
+	lintOut := flag.Bool("lint", false, "只做静态检查：以 JSON Lines 在标准输出逐行给出问题(rule/file/line/col/severity/message)，存在问题时以状态 1 退出，不需要 -output")
 	flag.Parse()
 
+	if *lintOut && *inPath != "" {
+		runLint(*inPath, out, src.defines)
+		return
+	}
+
 	if *inPath == "" || *outPath == "" {
 		fmt.Fprintln(os.Stderr, "用法: go run main.go -input code.s -output instr.txt")
+		fmt.Fprintln(os.Stderr, "      go run main.go link -output instr.txt a.o b.s ...")
+		fmt.Fprintln(os.Stderr, "      go run main.go fmt [-w] code.s ...")
 		os.Exit(2)
 	}
 
-	lines, err := parser.ReadFileLines(*inPath)
+	layout, err := out.layout(flag.CommandLine)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "读取输入文件失败:", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	mode := src.mode()
+
+	if *objOut {
+		items, labels, perr := parser.ParseFile(*inPath, src.defines)
+		if items == nil && perr != nil {
+			diag.Print(os.Stderr, perr)
+			os.Exit(1)
+		}
+		obj, diags := assembler.AssembleObject(*inPath, items, labels, mode)
+		diags = append(diag.AsList(perr), diags...)
+		diag.Print(os.Stderr, diags)
+		if diags.HasErrors() {
+			os.Exit(1)
+		}
+		if err := writeObject(*outPath, obj); err != nil {
+			fmt.Fprintln(os.Stderr, "写入目标文件失败:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("完成：写入目标文件 %s\n", *outPath)
+		return
+	}
+
+	// 解析出错时仍继续汇编，一次报告全部错误
+	prog, diags := assembler.AssembleFile(*inPath, assembler.Options{Layout: layout, Mode: mode, Defines: src.defines})
+	diag.Print(os.Stderr, diags)
+	if diags.HasErrors() {
 		os.Exit(1)
 	}
 
-	// 解析基址
-	baseVal, err := strconv.ParseUint(*baseStr, 16, 32)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "解析 base 失败:", err)
-		os.Exit(2)
+	if *listPath != "" {
+		if err := emitter.WriteListing(*listPath, prog.Listing); err != nil {
+			fmt.Fprintln(os.Stderr, "写入清单失败:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("完成：写入清单到 %s\n", *listPath)
 	}
 
-	items, labels, err := parser.ParseLines(lines)
+	out.write(*outPath, layout, prog.Text, prog.Data)
+}
+
+// runLint 实现 -lint：解析并检查 path，汇编错误按诊断格式写到标准错误
+func runLint(path string, out *output, defines defineFlags) {
+	layout, err := out.layout(flag.CommandLine)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "解析失败:", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	items, labels, perr := parser.ParseFile(path, defines)
+	if perr != nil {
+		diag.Print(os.Stderr, perr)
 		os.Exit(1)
 	}
+	findings, diags := lint.Check(items, labels, layout)
+	if diags.HasErrors() {
+		diag.Print(os.Stderr, diags)
+		os.Exit(1)
+	}
+	if err := lint.WriteJSON(os.Stdout, findings); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// output 是汇编与链接共用的布局与输出参数
+type output struct {
+	dataPath, memName, base, dataBase, format *string
+}
+
+func outputFlags(fs *flag.FlagSet) *output {
+	return &output{
+		dataPath: fs.String("data", "", "输出 .data 段镜像路径(默认与 -output 同目录的 data.txt，仅在存在数据时写入)"),
+		memName:  fs.String("mem", "", "内存布局名，决定 .text/.data 基址(可被 -base/-database 覆盖)。"+memcfg.Usage()),
+		base:     fs.String("base", "0", ".text 段基址(0x前缀十六进制),用于分支/跳转计算"),
+		dataBase: fs.String("database", "0", ".data 段基址(0x前缀十六进制)"),
+		format:   fs.String("format", "hex", "输出格式: "+strings.Join(emitter.Names(), ", ")),
+	}
+}
 
-	words, err := assembler.Assemble(items, labels, uint32(baseVal))
+// layout 解析基址：先取 -mem 布局，再以显式给出的 -base/-database 覆盖
+func (o *output) layout(fs *flag.FlagSet) (assembler.Layout, error) {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var text, data *uint32
+	if set["base"] {
+		v, err := parseHex(*o.base)
+		if err != nil {
+			return assembler.Layout{}, fmt.Errorf("解析 base 失败: %v", err)
+		}
+		text = &v
+	}
+	if set["database"] {
+		v, err := parseHex(*o.dataBase)
+		if err != nil {
+			return assembler.Layout{}, fmt.Errorf("解析 database 失败: %v", err)
+		}
+		data = &v
+	}
+	cfg, err := memcfg.Resolve(*o.memName, text, data)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "汇编失败:", err)
-		os.Exit(1)
+		return assembler.Layout{}, err
 	}
+	return assembler.Layout{TextBase: cfg.TextBase, DataBase: cfg.DataBase}, nil
+}
 
-	if err := emitter.WriteHexLines(*outPath, words); err != nil {
+// write 按 -format 写出 .text 与 .data 段镜像
+func (o *output) write(outPath string, layout assembler.Layout, words, data []uint32) {
+	if err := emitter.WriteFile(outPath, *o.format, layout.TextBase, words); err != nil {
 		fmt.Fprintln(os.Stderr, "写入失败:", err)
 		os.Exit(1)
 	}
+	fmt.Printf("完成：写入 %d 条指令到 %s\n", len(words), outPath)
+
+	if len(data) > 0 || *o.dataPath != "" {
+		p := *o.dataPath
+		if p == "" {
+			p = filepath.Join(filepath.Dir(outPath), "data.txt")
+		}
+		if err := emitter.WriteFile(p, *o.format, layout.DataBase, data); err != nil {
+			fmt.Fprintln(os.Stderr, "写入数据段失败:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("完成：写入 %d 个数据字到 %s\n", len(data), p)
+	}
+}
+
+// source 是汇编与链接共用的源文件参数
+type source struct {
+	strict, warn *bool
+	defines      defineFlags
+}
+
+func sourceFlags(fs *flag.FlagSet) *source {
+	s := &source{
+		strict:  fs.Bool("strict", false, "立即数越界、分支/跳转超出范围、未对齐访问视为错误"),
+		warn:    fs.Bool("warn", true, "把上述问题报告为警告后继续汇编；-warn=false 关闭检查"),
+		defines: defineFlags{},
+	}
+	fs.Var(s.defines, "D", "预定义符号 NAME=VAL(可重复，省略 =VAL 时为 1)，供 .ifdef/.if 与代码引用")
+	return s
+}
+
+// mode 返回 -strict/-warn 选定的检查方式
+func (s *source) mode() assembler.CheckMode {
+	switch {
+	case *s.strict:
+		return assembler.CheckStrict
+	case *s.warn:
+		return assembler.CheckWarn
+	}
+	return assembler.CheckOff
+}
+
+// parseHex 解析十六进制地址，0x 前缀可选
+func parseHex(s string) (uint32, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	v, err := strconv.ParseUint(s, 16, 32)
+	return uint32(v), err
+}
 
-	fmt.Printf("完成：写入 %d 条指令到 %s\n", len(words), *outPath)
+// defineFlags 收集可重复的 -D NAME=VAL
+type defineFlags map[string]string
+
+func (d defineFlags) String() string {
+	var parts []string
+	for k, v := range d {
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (d defineFlags) Set(s string) error {
+	name, val, ok := strings.Cut(s, "=")
+	if !ok {
+		val = "1"
+	}
+	if name == "" {
+		return fmt.Errorf("-D 需要 NAME=VAL")
+	}
+	d[name] = val
+	return nil
 }
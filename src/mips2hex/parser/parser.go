@@ -2,10 +2,16 @@ package parser
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 
+	"mips2hex/diag"
+	"mips2hex/lexer"
+	"mips2hex/pseudo"
 	"mips2hex/types"
 )
 
@@ -15,94 +21,158 @@ func ReadFileLines(path string) ([]string, error) {
 		return nil, err
 	}
 	defer f.Close()
+	return readLines(f)
+}
+
+func readLines(r io.Reader) ([]string, error) {
 	var lines []string
-	s := bufio.NewScanner(f)
+	s := bufio.NewScanner(r)
 	for s.Scan() {
 		lines = append(lines, s.Text())
 	}
 	return lines, s.Err()
 }
 
-// ParseLines 进行简单的两遍解析：收集 label 与 items (.word 也支持), .text 段启用
-// .text 起始地址假定为 0
-func ParseLines(lines []string) ([]types.Item, map[string]uint32, error) {
-	items := []types.Item{}
-	labels := map[string]uint32{}
-	addr := uint32(0)
-	inText := false
-	lineNo := 0
-	labelRe := regexp.MustCompile(`^([A-Za-z_\.][A-Za-z0-9_\.\$]*):`)
+var labelRe = regexp.MustCompile(`^([A-Za-z_\.][A-Za-z0-9_\.\$]*|[0-9]+):`)
 
-	for _, rawLine := range lines {
-		lineNo++
-		line := rawLine
-		// 删除注释 (# 和 //)
-		if i := strings.Index(line, "#"); i >= 0 {
-			line = line[:i]
-		}
-		if i := strings.Index(line, "//"); i >= 0 {
-			line = line[:i]
-		}
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		// directive
-		if strings.HasPrefix(line, ".") {
-			parts := fields(line)
-			dir := strings.ToLower(parts[0])
-			switch dir {
-			case ".text":
-				inText = true
-				continue
-			case ".data":
-				inText = false
-				continue
-			case ".word":
-				if !inText {
-					continue
-				}
-				rest := strings.TrimSpace(line[len(".word"):])
-				args := splitArgs(rest)
-				for _, a := range args {
-					it := types.Item{
-						Kind:     types.Word,
-						Raw:      a,
-						Tokens:   []string{a},
-						LineNo:   lineNo,
-						OrigLine: rawLine,
-					}
-					items = append(items, it)
-					addr += 4
-				}
-				continue
-			default:
-				// 忽略其他
-				continue
+// state 保存解析过程中的段与地址信息
+type state struct {
+	items  []types.Item
+	labels map[string]types.Symbol
+	seg    types.Segment
+	inSeg  bool                     // 是否已经进入 .text/.data 段
+	addrs  map[types.Segment]uint32 // 各段当前偏移
+	// pending 为尚未确定地址的标签：数据段中 .word/.half 会自动对齐，
+	// 紧邻其前的标签应指向对齐之后的地址
+	pending []pendingLabel
+	cur     srcLine // 当前行
+	diags   diag.List
+	globals []string // .globl 声明的符号
+	externs []string // .extern 声明的符号
+	// 数字局部标签 N: 可重复定义，第 k 次定义记为 LocalName(N, k)
+	locals     map[string]int // 已解析到的定义次数
+	localTotal map[string]int // 全部定义次数，用于检查向前引用
+}
+
+// MaxData 是 .space 可以使 .data 段达到的最大字节数，远大于 MARS 静态数据区（0x30000）
+const MaxData = 1 << 22
+
+// pendingLabel 是等待绑定的标签及其定义所在行
+type pendingLabel struct {
+	name string
+	at   srcLine
+}
+
+// LocalName 返回数字局部标签 n 第 k 次（从 0 计）定义的内部符号名
+func LocalName(n string, k int) string {
+	return fmt.Sprintf(".L%s$%d", n, k)
+}
+
+// IsLocal 报告 name 是否为数字局部标签的内部符号名
+func IsLocal(name string) bool {
+	return localNameRe.MatchString(name)
+}
+
+var localNameRe = regexp.MustCompile(`^\.L[0-9]+\$[0-9]+$`)
+
+// report 记录当前行的错误，解析继续进行
+func (st *state) report(err error) {
+	st.diags = append(st.diags, diag.AsList(st.cur.wrap(err))...)
+}
+
+// ParseFile 读取并解析 path，.include 相对其所在目录解析。
+// defines 为预定义符号（如命令行 -D NAME=VAL），可被 .ifdef/.if 与后续代码引用。
+func ParseFile(path string, defines map[string]string) ([]types.Item, map[string]types.Symbol, error) {
+	lines, err := ReadFileLines(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parse(lines, path, defines)
+}
+
+// ParseSource 解析内存中的源码 src，file 用于诊断中的文件名与 .include 的相对路径，可为空
+func ParseSource(src, file string, defines map[string]string) ([]types.Item, map[string]types.Symbol, error) {
+	lines, err := readLines(strings.NewReader(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	return parse(lines, file, defines)
+}
+
+// ParseLines 进行简单的两遍解析：收集 label 与 items, 支持 .text 与 .data 段
+// 各段起始地址均假定为 0，标签记录段内偏移。
+// 收集标签之前先处理 .include、条件汇编、.eqv 与 .macro（见 preprocess），
+// .include 相对当前目录解析。
+func ParseLines(lines []string) ([]types.Item, map[string]types.Symbol, error) {
+	return parse(lines, "", nil)
+}
+
+func parse(lines []string, file string, defines map[string]string) ([]types.Item, map[string]types.Symbol, error) {
+	// 预处理出错的行已被跳过，其余行继续解析，以便一次报告尽可能多的错误
+	src, err := preprocess(lines, file, defines)
+	st := &state{
+		labels: map[string]types.Symbol{},
+		addrs:  map[types.Segment]uint32{},
+		locals: map[string]int{},
+		diags:  diag.AsList(err),
+
+		localTotal: map[string]int{},
+	}
+	for _, sl := range src {
+		for _, l := range leadingLabels(sl.text) {
+			if isNumber(l) {
+				st.localTotal[l]++
 			}
 		}
+	}
+
+	for _, sl := range src {
+		line, lineNo, rawLine := sl.text, sl.lineNo, sl.raw
+		st.cur = sl
 		// labels
 		for {
 			m := labelRe.FindStringSubmatch(line)
 			if m == nil {
 				break
 			}
-			label := m[1]
-			labels[label] = addr
+			if isNumber(m[1]) {
+				st.pending = append(st.pending, pendingLabel{LocalName(m[1], st.locals[m[1]]), sl})
+				st.locals[m[1]]++
+			} else if st.defined(m[1]) {
+				st.report(diag.Tok(m[1], fmt.Errorf("标签 %s 重复定义", m[1])))
+			} else {
+				st.pending = append(st.pending, pendingLabel{m[1], sl})
+			}
 			// 去掉该前缀 label: 部分，继续循环以处理多个 label
 			line = strings.TrimSpace(line[len(m[0]):])
-			if line == "" {
-				// 如果 label 后面没有任何指令或内容，该行结束，继续到下一行
-				break
-			}
 		}
 		if line == "" {
 			continue
 		}
-		if !inText {
+		line, err := st.localRefs(line)
+		if err != nil {
+			st.report(err)
+			continue
+		}
+		// directive
+		if strings.HasPrefix(line, ".") {
+			if err := st.directive(line, lineNo, rawLine); err != nil {
+				st.report(err)
+			}
+			continue
+		}
+		if !st.inSeg {
+			continue
+		}
+		if st.seg != types.Text {
+			st.report(fmt.Errorf(".data 段中不能出现指令: %s", line))
+			continue
+		}
+		toks, err := Tokenize(line)
+		if err != nil {
+			st.report(err)
 			continue
 		}
-		toks := tokenize(line)
 		if len(toks) == 0 {
 			continue
 		}
@@ -112,31 +182,335 @@ func ParseLines(lines []string) ([]types.Item, map[string]uint32, error) {
 			Tokens:   toks,
 			LineNo:   lineNo,
 			OrigLine: rawLine,
-			Size:     4,
+			Size:     pseudo.Size(toks),
+		}
+		st.emit(it)
+	}
+	st.flushLabels()
+	st.linkage()
+	return st.items, st.labels, st.diags.Err()
+}
+
+func isNumber(s string) bool {
+	return strings.Trim(s, "0123456789") == ""
+}
+
+// localRefs 把语句中的局部标签引用改写为对应定义的内部符号名：
+// 1f 为其后最近的 1:，1b 为其前最近的 1:。无法切分的行原样返回，由之后的处理报告错误。
+func (st *state) localRefs(line string) (string, error) {
+	toks, err := lexer.Lex(line)
+	if err != nil {
+		return line, nil
+	}
+	for i := len(toks) - 1; i >= 0; i-- {
+		t := toks[i]
+		if !lexer.IsLocalRef(t) {
+			continue
+		}
+		n, k := t.Text[:len(t.Text)-1], st.locals[t.Text[:len(t.Text)-1]]
+		if t.Text[len(t.Text)-1] == 'b' {
+			k--
+		}
+		switch {
+		case k < 0:
+			return "", diag.Tok(t.Text, fmt.Errorf("局部标签 %s 之前没有定义 %s:", t.Text, n))
+		case k >= st.localTotal[n]:
+			return "", diag.Tok(t.Text, fmt.Errorf("局部标签 %s 之后没有定义 %s:", t.Text, n))
+		}
+		line = line[:t.Col-1] + LocalName(n, k) + line[t.End():]
+	}
+	return line, nil
+}
+
+// linkage 标记 .globl 导出的符号；.extern 与 .globl 声明但本文件未定义的符号记为外部符号
+func (st *state) linkage() {
+	for _, name := range st.externs {
+		if _, ok := st.labels[name]; !ok {
+			st.labels[name] = types.Symbol{Extern: true}
 		}
-		if strings.ToLower(toks[0]) == "li" {
-			it.Size = 8
+	}
+	for _, name := range st.globals {
+		sym, ok := st.labels[name]
+		if !ok {
+			sym.Extern = true
+		}
+		sym.Global = true
+		st.labels[name] = sym
+	}
+}
+
+// directive 处理以 . 开头的伪指令
+func (st *state) directive(line string, lineNo int, rawLine string) error {
+	parts := fields(line)
+	dir := strings.ToLower(parts[0])
+	rest := strings.TrimSpace(line[len(parts[0]):])
+	switch dir {
+	case ".text":
+		st.switchSeg(types.Text)
+		return nil
+	case ".data":
+		st.switchSeg(types.Data)
+		return nil
+	case ".globl", ".global", ".extern":
+		// .extern 的第二个操作数（MARS 中为大小）忽略
+		names := strings.FieldsFunc(rest, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(names) == 0 {
+			return fmt.Errorf("%s 缺少符号名", dir)
+		}
+		if dir == ".extern" {
+			st.externs = append(st.externs, names[0])
+		} else {
+			st.globals = append(st.globals, names...)
+		}
+		return nil
+	}
+	if !st.inSeg {
+		return nil
+	}
+	base := types.Item{LineNo: lineNo, OrigLine: rawLine}
+
+	switch dir {
+	case ".word", ".half", ".byte":
+		kind, size := types.Word, uint32(4)
+		switch dir {
+		case ".half":
+			kind, size = types.Half, 2
+		case ".byte":
+			kind, size = types.Byte, 1
+		}
+		if st.seg == types.Text && dir != ".word" {
+			return fmt.Errorf("%s 只能用于 .data 段", dir)
+		}
+		if rest == "" {
+			return fmt.Errorf("%s 缺少操作数", dir)
+		}
+		toks, err := lexer.Lex(rest)
+		if err != nil {
+			return err
+		}
+		st.align(size, lineNo, rawLine)
+		for _, a := range operands(rest, toks, false) {
+			it := base
+			it.Kind = kind
+			it.Raw = a
+			it.Tokens = []string{a}
+			it.Size = size
+			st.emit(it)
+		}
+	case ".space":
+		if st.seg != types.Data {
+			return fmt.Errorf("%s 只能用于 .data 段", dir)
+		}
+		n, err := strconv.ParseUint(rest, 0, 32)
+		if err != nil {
+			return fmt.Errorf(".space 大小解析失败: %v", err)
+		}
+		if uint64(st.addrs[st.seg])+n > MaxData {
+			return diag.Tok(rest, fmt.Errorf(".space %s 使 .data 段超过 %d 字节上限", rest, MaxData))
+		}
+		it := base
+		it.Kind = types.Bytes
+		it.Raw = line
+		it.Bytes = make([]byte, n)
+		it.Size = uint32(n)
+		st.emit(it)
+	case ".ascii", ".asciiz":
+		if st.seg != types.Data {
+			return fmt.Errorf("%s 只能用于 .data 段", dir)
+		}
+		b, err := parseStrings(rest)
+		if err != nil {
+			return fmt.Errorf("%s 字符串解析失败: %w", dir, err)
+		}
+		if dir == ".asciiz" {
+			b = append(b, 0)
+		}
+		it := base
+		it.Kind = types.Bytes
+		it.Raw = line
+		it.Bytes = b
+		it.Size = uint32(len(b))
+		st.emit(it)
+	case ".align":
+		n, err := strconv.ParseUint(rest, 0, 32)
+		if err != nil || n > 16 {
+			return fmt.Errorf(".align 参数非法: %s", rest)
+		}
+		if st.seg == types.Text && n < 2 {
+			return nil
+		}
+		st.align(uint32(1)<<n, lineNo, rawLine)
+	default:
+		// 忽略其他
+	}
+	return nil
+}
+
+func (st *state) switchSeg(seg types.Segment) {
+	st.flushLabels()
+	st.seg = seg
+	st.inSeg = true
+}
+
+// emit 追加 item 并把挂起的标签绑定到它的地址
+func (st *state) emit(it types.Item) {
+	it.Seg = st.seg
+	it.Addr = st.addrs[st.seg]
+	it.File, it.Macro = st.cur.file, st.cur.macro
+	st.flushLabels()
+	st.items = append(st.items, it)
+	st.addrs[st.seg] += it.Size
+}
+
+func (st *state) flushLabels() {
+	if !st.inSeg {
+		// 段指令之前的标签留给第一个段
+		return
+	}
+	for _, l := range st.pending {
+		st.labels[l.name] = types.Symbol{
+			Seg: st.seg, Addr: st.addrs[st.seg], Item: len(st.items),
+			File: l.at.file, LineNo: l.at.lineNo, Source: l.at.raw,
+		}
+	}
+	st.pending = nil
+}
+
+// defined 报告标签是否已定义或正等待绑定
+func (st *state) defined(l string) bool {
+	if _, ok := st.labels[l]; ok {
+		return true
+	}
+	for _, p := range st.pending {
+		if p.name == l {
+			return true
+		}
+	}
+	return false
+}
+
+// align 以零字节填充，使当前段偏移按 n 字节对齐
+func (st *state) align(n uint32, lineNo int, rawLine string) {
+	addr := st.addrs[st.seg]
+	pad := (n - addr%n) % n
+	// .text 中指令长度可能在汇编时变化，即使当前无需填充也保留该 item
+	if pad == 0 && st.seg != types.Text {
+		return
+	}
+	// 填充不属于任何标签，挂起的标签留给后续 item
+	st.items = append(st.items, types.Item{
+		Kind:     types.Bytes,
+		Seg:      st.seg,
+		LineNo:   lineNo,
+		OrigLine: rawLine,
+		Size:     pad,
+		Addr:     addr,
+		Bytes:    make([]byte, pad),
+		Align:    n,
+		File:     st.cur.file,
+		Macro:    st.cur.macro,
+	})
+	st.addrs[st.seg] += pad
+}
+
+// parseStrings 解析以逗号分隔的若干双引号字符串，转义见 lexer
+func parseStrings(s string) ([]byte, error) {
+	toks, err := lexer.Lex(s)
+	if err != nil {
+		return nil, err
+	}
+	var out []byte
+	for i := 0; ; i += 2 {
+		if i >= len(toks) || toks[i].Kind != lexer.String {
+			return nil, fmt.Errorf("期望双引号字符串: %s", rest(s, toks, i))
+		}
+		out = append(out, toks[i].Bytes...)
+		if i+1 == len(toks) {
+			return out, nil
+		}
+		if toks[i+1].Text != "," {
+			return nil, fmt.Errorf("多余内容: %s", rest(s, toks, i+1))
 		}
-		items = append(items, it)
-		addr += it.Size
 	}
-	return items, labels, nil
+}
+
+// rest 返回从第 i 个记号开始的源码
+func rest(s string, toks []lexer.Token, i int) string {
+	if i >= len(toks) {
+		return ""
+	}
+	return s[toks[i].Col-1:]
 }
 
 func fields(s string) []string {
 	return strings.Fields(s)
 }
 
-func splitArgs(s string) []string {
-	parts := strings.Split(s, ",")
-	for i := range parts {
-		parts[i] = strings.TrimSpace(parts[i])
+// Tokenize 把语句拆为助记符与各操作数，见 operands
+func Tokenize(s string) ([]string, error) {
+	toks, err := lexer.Lex(s)
+	if err != nil || len(toks) == 0 {
+		return nil, err
+	}
+	if len(toks) == 1 {
+		return []string{toks[0].Text}, nil
+	}
+	return append([]string{toks[0].Text}, operands(s, toks[1:], true)...), nil
+}
+
+// operands 按括号外的逗号拆分记号，返回各操作数在 s 中的源码。操作数可以是含空白的表达式，
+// 如 (END - START) / 4。spaces 为真且没有逗号时按空白拆分，以兼容 add $t0 $t1 $t2 这类写法，
+// 但与运算符相邻以及括号内的空白不拆分。
+func operands(s string, toks []lexer.Token, spaces bool) []string {
+	var groups [][]lexer.Token
+	var cur []lexer.Token
+	depth := 0
+	for _, t := range toks {
+		switch {
+		case t.Kind == lexer.Punct && t.Text == "(":
+			depth++
+		case t.Kind == lexer.Punct && t.Text == ")":
+			depth--
+		case t.Kind == lexer.Punct && t.Text == "," && depth == 0:
+			groups = append(groups, cur)
+			cur = nil
+			continue
+		}
+		cur = append(cur, t)
+	}
+	groups = append(groups, cur)
+	if len(groups) == 1 && spaces {
+		groups = splitSpaces(cur)
+	}
+	out := make([]string, len(groups))
+	for i, g := range groups {
+		if len(g) > 0 {
+			out[i] = s[g[0].Col-1 : g[len(g)-1].End()]
+		}
 	}
-	return parts
+	return out
 }
 
-func tokenize(s string) []string {
-	s = strings.ReplaceAll(s, ",", " ")
-	parts := strings.Fields(s)
-	return parts
+// splitSpaces 在空白处拆分记号，与运算符相邻以及括号内的空白除外
+func splitSpaces(toks []lexer.Token) [][]lexer.Token {
+	const ops = "+-*/%&|^~<>(!="
+	var out [][]lexer.Token
+	depth := 0
+	for i, t := range toks {
+		if i == 0 {
+			out = append(out, nil)
+		} else if prev := toks[i-1]; t.Col-1 > prev.End() && depth == 0 &&
+			!(prev.Kind == lexer.Punct && strings.ContainsAny(prev.Text[len(prev.Text)-1:], ops)) &&
+			!(t.Kind == lexer.Punct && strings.ContainsAny(t.Text[:1], ops+")")) {
+			out = append(out, nil)
+		}
+		switch t.Text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+		}
+		out[len(out)-1] = append(out[len(out)-1], t)
+	}
+	return out
 }
@@ -0,0 +1,481 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mips2hex/diag"
+	"mips2hex/expr"
+	"mips2hex/lexer"
+	"mips2hex/types"
+)
+
+// srcLine 是预处理后的一行源码
+type srcLine struct {
+	text   string // 已去掉注释，完成 .eqv 与宏参数替换
+	file   string // 所在文件，直接传入 ParseLines 的源码为空
+	lineNo int
+	raw    string
+	macro  *types.MacroCall
+}
+
+// wrap 把该行相关的错误转换为诊断
+func (l srcLine) wrap(err error) error {
+	return types.Item{File: l.file, LineNo: l.lineNo, OrigLine: l.raw, Macro: l.macro}.Diag(diag.Error, err)
+}
+
+// macroDef 是一个 .macro 定义，MARS 允许同名宏按参数个数重载
+type macroDef struct {
+	name   string
+	params []string // 含 % 前缀
+	body   []srcLine
+	labels []string // 宏体中定义的标签，展开时改名为局部标签
+	start  srcLine  // .macro 所在行
+}
+
+// maxMacroDepth 限制宏的嵌套展开深度，防止递归宏无限展开
+const maxMacroDepth = 64
+
+// cond 是一层 .if/.ifdef 条件汇编
+type cond struct {
+	active   bool // 当前分支是否参与汇编
+	taken    bool // 是否已有分支参与汇编，用于 .else
+	seenElse bool
+	start    srcLine
+}
+
+type preproc struct {
+	eqv      map[string]string
+	macros   map[string][]*macroDef
+	count    int // 已展开的宏次数，用于生成局部标签名
+	out      []srcLine
+	diags    diag.List
+	def      *macroDef // 正在收集的宏定义
+	conds    []cond
+	includes []string // 正在处理的文件（绝对路径），用于检测循环包含
+}
+
+var (
+	macroNameRe = regexp.MustCompile(`^[A-Za-z_\.][A-Za-z0-9_\.\$]*`)
+	paramRe     = regexp.MustCompile(`^%[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// preprocess 在收集标签之前处理 .include、条件汇编、.eqv 与 .macro/.end_macro，
+// 返回去掉注释、完成替换与宏展开后的源码行。
+// file 为源码所在文件，.include 相对其所在目录解析；defines 为预定义的符号（如 -D），
+// 与 .eqv 定义的符号等价。
+func preprocess(lines []string, file string, defines map[string]string) ([]srcLine, error) {
+	pp := &preproc{
+		eqv:    map[string]string{},
+		macros: map[string][]*macroDef{},
+	}
+	for k, v := range defines {
+		pp.eqv[k] = v
+	}
+	if file != "" {
+		if abs, err := filepath.Abs(file); err == nil {
+			pp.includes = append(pp.includes, abs)
+		}
+	}
+	pp.run(lines, file)
+	return pp.out, pp.diags.Err()
+}
+
+// run 逐行处理一个文件，文件结束时宏定义与条件汇编须已闭合。
+// 出错的行记录诊断后跳过，继续处理后续行。
+func (pp *preproc) run(lines []string, file string) {
+	conds := len(pp.conds)
+	for i, raw := range lines {
+		raw = strings.TrimSuffix(raw, "\r") // CRLF 换行
+		l := srcLine{text: strings.TrimSpace(lexer.StripComment(raw)), file: file, lineNo: i + 1, raw: raw}
+		if l.text == "" {
+			continue
+		}
+		if err := pp.line(l, 0); err != nil {
+			pp.report(err)
+		}
+	}
+	if pp.def != nil {
+		pp.report(pp.def.start.wrap(fmt.Errorf(".macro %s 缺少 .end_macro", pp.def.name)))
+		pp.def = nil
+	}
+	for len(pp.conds) > conds {
+		c := pp.conds[len(pp.conds)-1]
+		pp.report(c.start.wrap(fmt.Errorf(".if 缺少 .endif")))
+		pp.conds = pp.conds[:len(pp.conds)-1]
+	}
+}
+
+func (pp *preproc) report(err error) {
+	pp.diags = append(pp.diags, diag.AsList(err)...)
+}
+
+func (pp *preproc) active() bool {
+	return len(pp.conds) == 0 || pp.conds[len(pp.conds)-1].active
+}
+
+// line 处理一行：收集宏定义，处理条件汇编、.include 与 .eqv，替换 .eqv 符号，展开宏调用
+func (pp *preproc) line(l srcLine, depth int) error {
+	dir := strings.ToLower(firstField(l.text))
+	if d := pp.def; d != nil {
+		switch dir {
+		case ".end_macro":
+			pp.macros[d.name] = append(pp.macros[d.name], d)
+			pp.def = nil
+		case ".macro":
+			return l.wrap(fmt.Errorf("宏定义不能嵌套"))
+		default:
+			d.body = append(d.body, l)
+			d.labels = append(d.labels, leadingLabels(l.text)...)
+		}
+		return nil
+	}
+
+	eqv := func(s string) string {
+		return replaceIdents(s, func(id string) (string, bool) {
+			v, ok := pp.eqv[id]
+			return v, ok
+		})
+	}
+	arg := strings.TrimSpace(strings.TrimPrefix(l.text, firstField(l.text)))
+
+	switch dir {
+	case ".if", ".ifdef", ".ifndef":
+		c := cond{start: l}
+		if pp.active() {
+			var ok bool
+			switch dir {
+			case ".if":
+				v, err := expr.Eval(eqv(arg), nil)
+				if err != nil {
+					return l.wrap(diag.Tok(arg, fmt.Errorf(".if 条件求值失败: %v", err)))
+				}
+				ok = v != 0
+			case ".ifdef":
+				_, ok = pp.eqv[arg]
+			default:
+				_, ok = pp.eqv[arg]
+				ok = !ok
+			}
+			c.active, c.taken = ok, ok
+		} else {
+			// 外层不参与汇编时内层所有分支都跳过
+			c.taken = true
+		}
+		pp.conds = append(pp.conds, c)
+		return nil
+	case ".else":
+		if len(pp.conds) == 0 {
+			return l.wrap(fmt.Errorf(".else 没有对应的 .if"))
+		}
+		c := &pp.conds[len(pp.conds)-1]
+		if c.seenElse {
+			return l.wrap(fmt.Errorf("重复的 .else"))
+		}
+		c.seenElse = true
+		c.active = !c.taken
+		c.taken = true
+		return nil
+	case ".endif":
+		if len(pp.conds) == 0 {
+			return l.wrap(fmt.Errorf(".endif 没有对应的 .if"))
+		}
+		pp.conds = pp.conds[:len(pp.conds)-1]
+		return nil
+	}
+	if !pp.active() {
+		return nil
+	}
+
+	switch dir {
+	case ".macro":
+		d, err := parseMacroHeader(l.text)
+		if err != nil {
+			return l.wrap(err)
+		}
+		d.start = l
+		pp.def = d
+		return nil
+	case ".end_macro":
+		return l.wrap(fmt.Errorf(".end_macro 没有对应的 .macro"))
+	case ".include":
+		return pp.include(l, arg)
+	case ".eqv":
+		parts := strings.Fields(l.text)
+		if len(parts) < 3 || !identRe.MatchString(parts[1]) {
+			return l.wrap(fmt.Errorf(".eqv 需要 名称 与 值"))
+		}
+		// 值取名称之后的全部文本；名称可能同时出现在 .eqv 中（如 .eqv v 5）
+		_, value, _ := strings.Cut(strings.TrimSpace(l.text)[len(parts[0]):], parts[1])
+		value = strings.TrimSpace(value)
+		pp.eqv[parts[1]] = eqv(value)
+		return nil
+	}
+	l.text = eqv(l.text)
+
+	rest := l.text
+	var labels []string
+	for {
+		m := labelRe.FindStringSubmatch(rest)
+		if m == nil {
+			break
+		}
+		labels = append(labels, m[0])
+		rest = strings.TrimSpace(rest[len(m[0]):])
+	}
+
+	name := macroNameRe.FindString(rest)
+	defs, ok := pp.macros[name]
+	if name == "" || !ok {
+		pp.out = append(pp.out, l)
+		return nil
+	}
+	args, err := macroArgs(strings.TrimSpace(rest[len(name):]))
+	if err != nil {
+		return l.wrap(err)
+	}
+	var def *macroDef
+	for _, d := range defs {
+		if len(d.params) == len(args) {
+			def = d
+		}
+	}
+	if def == nil {
+		return l.wrap(diag.Tok(name, fmt.Errorf("宏 %s 没有接受 %d 个参数的定义", name, len(args))))
+	}
+	if depth >= maxMacroDepth {
+		return l.wrap(fmt.Errorf("宏 %s 嵌套展开超过 %d 层", name, maxMacroDepth))
+	}
+
+	// 调用行上的标签保留在展开结果之前
+	if len(labels) > 0 {
+		pp.out = append(pp.out, srcLine{text: strings.Join(labels, " "), file: l.file, lineNo: l.lineNo, raw: l.raw, macro: l.macro})
+	}
+
+	call := &types.MacroCall{Name: name, File: l.file, LineNo: l.lineNo, Source: l.raw, Parent: l.macro}
+	suffix := fmt.Sprintf("_M%d", pp.count)
+	pp.count++
+	local := map[string]bool{}
+	for _, lb := range def.labels {
+		local[lb] = true
+	}
+	conds := len(pp.conds)
+	for _, b := range def.body {
+		text, err := substituteParams(b.text, def, args)
+		if err != nil {
+			return srcLine{file: b.file, lineNo: b.lineNo, raw: b.raw, macro: call}.wrap(err)
+		}
+		text = replaceIdents(text, func(id string) (string, bool) {
+			if local[id] {
+				return id + suffix, true
+			}
+			return "", false
+		})
+		if err := pp.line(srcLine{text: text, file: b.file, lineNo: b.lineNo, raw: b.raw, macro: call}, depth+1); err != nil {
+			return err
+		}
+	}
+	if len(pp.conds) != conds {
+		return l.wrap(fmt.Errorf("宏 %s 中的 .if/.endif 不配对", name))
+	}
+	return nil
+}
+
+// include 处理 .include "file"，路径相对于包含它的文件所在目录
+func (pp *preproc) include(l srcLine, arg string) error {
+	name, err := strconv.Unquote(arg)
+	if err != nil {
+		return l.wrap(diag.Tok(arg, fmt.Errorf(".include 需要带引号的文件名: %s", arg)))
+	}
+	path := name
+	if !filepath.IsAbs(path) && l.file != "" {
+		path = filepath.Join(filepath.Dir(l.file), path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return l.wrap(fmt.Errorf(".include %s: %v", name, err))
+	}
+	for _, f := range pp.includes {
+		if f == abs {
+			return l.wrap(diag.Tok(arg, fmt.Errorf("循环包含 %s", name)))
+		}
+	}
+	lines, err := ReadFileLines(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return l.wrap(diag.Tok(arg, fmt.Errorf(".include 找不到文件 %s", path)))
+		}
+		return l.wrap(fmt.Errorf(".include %s: %v", path, err))
+	}
+	pp.includes = append(pp.includes, abs)
+	pp.run(lines, path)
+	pp.includes = pp.includes[:len(pp.includes)-1]
+	return nil
+}
+
+// parseMacroHeader 解析 .macro name(%a, %b)、.macro name %a, %b 或 .macro name
+func parseMacroHeader(text string) (*macroDef, error) {
+	rest := strings.TrimSpace(text[len(".macro"):])
+	name := macroNameRe.FindString(rest)
+	if name == "" {
+		return nil, fmt.Errorf(".macro 缺少宏名")
+	}
+	d := &macroDef{name: name}
+	params, err := macroArgs(strings.TrimSpace(rest[len(name):]))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range params {
+		if !paramRe.MatchString(p) {
+			return nil, fmt.Errorf("宏 %s 的参数 %s 非法，参数须以 %% 开头", name, p)
+		}
+		d.params = append(d.params, p)
+	}
+	return d, nil
+}
+
+// macroArgs 拆分宏调用或定义的参数，接受 (a, b) 与 a, b 两种写法
+func macroArgs(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+		if s == "" {
+			return nil, nil
+		}
+	}
+	toks, err := lexer.Lex(s)
+	if err != nil {
+		return nil, err
+	}
+	return operands(s, toks, true), nil
+}
+
+// substituteParams 把宏体中的 %参数 替换为实参；%hi/%lo 运算符不是参数
+func substituteParams(text string, def *macroDef, args []string) (string, error) {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			b.WriteByte(c)
+			if c == '\\' && i+1 < len(text) {
+				i++
+				b.WriteByte(text[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if c == '"' || c == '\'' {
+			quote = c
+			b.WriteByte(c)
+			continue
+		}
+		if c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(text) && isIdentChar(text[j]) && text[j] != '.' && text[j] != '$' {
+			j++
+		}
+		name := text[i:j]
+		found := false
+		for k, p := range def.params {
+			if p == name {
+				b.WriteString(args[k])
+				found = true
+				break
+			}
+		}
+		if !found {
+			if name != "%hi" && name != "%lo" && name != "%" {
+				return "", fmt.Errorf("宏 %s 中未定义的参数 %s", def.name, name)
+			}
+			b.WriteString(name)
+		}
+		i = j - 1
+	}
+	return b.String(), nil
+}
+
+// replaceIdents 替换引号之外的标识符；$ 与 % 开头的寄存器、宏参数不参与替换
+func replaceIdents(text string, repl func(string) (string, bool)) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			b.WriteByte(c)
+			if c == '\\' && i+1 < len(text) {
+				i++
+				b.WriteByte(text[i])
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			b.WriteByte(c)
+		case c == '$' || c == '%' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(text) && isIdentChar(text[j]) {
+				j++
+			}
+			b.WriteString(text[i:j])
+			i = j - 1
+		case isIdentStart(c):
+			j := i + 1
+			for j < len(text) && isIdentChar(text[j]) {
+				j++
+			}
+			id := text[i:j]
+			if v, ok := repl(id); ok {
+				b.WriteString(v)
+			} else {
+				b.WriteString(id)
+			}
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || c == '$' || (c >= '0' && c <= '9')
+}
+
+var identRe = regexp.MustCompile(`^[A-Za-z_\.][A-Za-z0-9_\.\$]*$`)
+
+// leadingLabels 返回行首定义的标签名
+func leadingLabels(text string) []string {
+	var out []string
+	for {
+		m := labelRe.FindStringSubmatch(text)
+		if m == nil {
+			return out
+		}
+		out = append(out, m[1])
+		text = strings.TrimSpace(text[len(m[0]):])
+	}
+}
+
+func firstField(s string) string {
+	if f := fields(s); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
@@ -0,0 +1,711 @@
+package pseudo
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mips2hex/diag"
+	"mips2hex/expr"
+	"mips2hex/lexer"
+)
+
+// Class 是操作数的语法类别，划分方式与 MARS 的 TokenTypes 一致
+type Class int
+
+const (
+	None     Class = iota // 内存操作数没有偏移，如 ($t2)
+	Reg                   // $t1
+	Imm5                  // 0..31
+	Imm16U                // 32..65535
+	Imm16                 // -32768..-1
+	Imm32                 // 其余 32 位整数
+	Label                 // 标签
+	LabelOff              // 标签+立即数
+	Unknown
+)
+
+// Operand 是一个以逗号分隔的操作数。内存操作数 off(base) 的 Class 描述偏移部分，
+// Base 为基址寄存器；其他操作数 Base 为空。
+type Operand struct {
+	Text  string
+	Class Class
+	Mem   bool
+	Off   string // 内存操作数的偏移文本，其余情况等于 Text
+	Base  string
+	Value int32 // 整数类操作数的值
+	Err   error // 表达式求值失败的原因，此时类别为 Unknown
+}
+
+// Form 是一条伪指令的一种写法及其展开模板
+type Form struct {
+	Op       string
+	Operands []Operand
+	// Templates 为展开后的基本指令模板；Compact 为 MARS 在紧凑内存配置下使用的较短展开，
+	// 仅含 VLn 形式的值，要求值落在有符号 16 位范围内
+	Templates []string
+	Compact   []string
+}
+
+var (
+	forms  = map[string][]*Form{}
+	basics = map[string][]*Form{}
+)
+
+// 以下写法与展开模板取自 MARS 4.5 的 PseudoOps.txt（整数部分），改写为按操作数编号：
+//
+//	RGn   第 n 个操作数的寄存器；对内存操作数 off(base) 为 base
+//	NRn   比 RGn 大 1 的寄存器
+//	OPn   第 n 个操作数原文
+//	VLn   第 n 个操作数值(内存操作数取偏移，标签取地址)的低 16 位，有符号
+//	VLnU  低 16 位，无符号
+//	VHn   高 16 位，若低 16 位按有符号解释为负则加 1，配合 VLn($1) 寻址使用
+//	VHLn  高 16 位，不作修正，配合 ori 使用
+//	Pm    后缀，先给值加 m 再取位，如 VL2P1U、VHL2P1
+//	LAB   最后一个操作数(分支目标标签)原文
+//	S32   32 减去最后一个操作数的值
+//	BROFF12 未启用延迟分支时的分支偏移 1
+//
+// MARS 中的 LLn/LHn/LHL/LLP/LHPA/LHPN 等标签码在地址解析后与对应的 V 码等价，这里统一写作 V 码。
+// 延迟分支槽 DBNOP 在 MARS 默认设置下不生成，故省略。
+// li $t1,label 不属于 MARS，为兼容早先 mips2hex 接受 li 标签的写法而保留，展开同 la。
+var table = `
+not $t1,$t2	nor RG1, RG2, $0
+add $t1,$t2,-100	addi RG1, RG2, VL3
+add $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	add RG1, RG2, $1
+addu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	addu RG1, RG2, $1
+addi $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	add RG1, RG2, $1
+addiu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	addu RG1, RG2, $1
+sub $t1,$t2,-100	addi $1, $0, VL3	sub RG1, RG2, $1
+sub $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	sub RG1, RG2, $1
+subu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	subu RG1, RG2, $1
+subi $t1,$t2,-100	addi $1, $0, VL3	sub RG1, RG2, $1
+subi $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	sub RG1, RG2, $1
+subiu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	subu RG1, RG2, $1
+andi $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	and RG1, RG2, $1
+ori $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	or RG1, RG2, $1
+xori $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	xor RG1, RG2, $1
+and $t1,$t2,100	andi RG1, RG2, VL3U
+or $t1,$t2,100	ori RG1, RG2, VL3U
+xor $t1,$t2,100	xori RG1, RG2, VL3U
+and $t1,100	andi RG1, RG1, VL2U
+or $t1,100	ori RG1, RG1, VL2U
+xor $t1,100	xori RG1, RG1, VL2U
+andi $t1,100	andi RG1, RG1, VL2U
+ori $t1,100	ori RG1, RG1, VL2U
+xori $t1,100	xori RG1, RG1, VL2U
+andi $t1,100000	lui $1, VHL2	ori $1, $1, VL2U	and RG1, RG1, $1
+ori $t1,100000	lui $1, VHL2	ori $1, $1, VL2U	or RG1, RG1, $1
+xori $t1,100000	lui $1, VHL2	ori $1, $1, VL2U	xor RG1, RG1, $1
+
+seq $t1,$t2,$t3	subu RG1, RG2, RG3	ori $1, $0, 1	sltu RG1, RG1, $1
+seq $t1,$t2,-100	addi $1, $0, VL3	subu RG1, RG2, $1	ori $1, $0, 1	sltu RG1, RG1, $1
+seq $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	subu RG1, RG2, $1	ori $1, $0, 1	sltu RG1, RG1, $1
+sne $t1,$t2,$t3	subu RG1, RG2, RG3	sltu RG1, $0, RG1
+sne $t1,$t2,-100	addi $1, $0, VL3	subu RG1, RG2, $1	sltu RG1, $0, RG1
+sne $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	subu RG1, RG2, $1	sltu RG1, $0, RG1
+sge $t1,$t2,$t3	slt RG1, RG2, RG3	ori $1, $0, 1	subu RG1, $1, RG1
+sge $t1,$t2,-100	addi $1, $0, VL3	slt RG1, RG2, $1	ori $1, $0, 1	subu RG1, $1, RG1
+sge $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	slt RG1, RG2, $1	ori $1, $0, 1	subu RG1, $1, RG1
+sgeu $t1,$t2,$t3	sltu RG1, RG2, RG3	ori $1, $0, 1	subu RG1, $1, RG1
+sgeu $t1,$t2,-100	addi $1, $0, VL3	sltu RG1, RG2, $1	ori $1, $0, 1	subu RG1, $1, RG1
+sgeu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	sltu RG1, RG2, $1	ori $1, $0, 1	subu RG1, $1, RG1
+sgt $t1,$t2,$t3	slt RG1, RG3, RG2
+sgt $t1,$t2,-100	addi $1, $0, VL3	slt RG1, $1, RG2
+sgt $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	slt RG1, $1, RG2
+sgtu $t1,$t2,$t3	sltu RG1, RG3, RG2
+sgtu $t1,$t2,-100	addi $1, $0, VL3	sltu RG1, $1, RG2
+sgtu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	sltu RG1, $1, RG2
+sle $t1,$t2,$t3	slt RG1, RG3, RG2	ori $1, $0, 1	subu RG1, $1, RG1
+sle $t1,$t2,-100	addi $1, $0, VL3	slt RG1, $1, RG2	ori $1, $0, 1	subu RG1, $1, RG1
+sle $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	slt RG1, $1, RG2	ori $1, $0, 1	subu RG1, $1, RG1
+sleu $t1,$t2,$t3	sltu RG1, RG3, RG2	ori $1, $0, 1	subu RG1, $1, RG1
+sleu $t1,$t2,-100	addi $1, $0, VL3	sltu RG1, $1, RG2	ori $1, $0, 1	subu RG1, $1, RG1
+sleu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	sltu RG1, $1, RG2	ori $1, $0, 1	subu RG1, $1, RG1
+
+move $t1,$t2	addu RG1, $0, RG2
+abs $t1,$t2	sra $1, RG2, 31	xor RG1, $1, RG2	subu RG1, RG1, $1
+neg $t1,$t2	sub RG1, $0, RG2
+negu $t1,$t2	subu RG1, $0, RG2
+
+b label	bgez $0, LAB
+beqz $t1,label	beq RG1, $0, LAB
+bnez $t1,label	bne RG1, $0, LAB
+beq $t1,-100,label	addi $1, $0, VL2	beq $1, RG1, LAB
+beq $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	beq $1, RG1, LAB
+bne $t1,-100,label	addi $1, $0, VL2	bne $1, RG1, LAB
+bne $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	bne $1, RG1, LAB
+bge $t1,$t2,label	slt $1, RG1, RG2	beq $1, $0, LAB
+bge $t1,-100,label	slti $1, RG1, VL2	beq $1, $0, LAB
+bge $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	slt $1, RG1, $1	beq $1, $0, LAB
+bgeu $t1,$t2,label	sltu $1, RG1, RG2	beq $1, $0, LAB
+bgeu $t1,-100,label	sltiu $1, RG1, VL2	beq $1, $0, LAB
+bgeu $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	sltu $1, RG1, $1	beq $1, $0, LAB
+bgt $t1,$t2,label	slt $1, RG2, RG1	bne $1, $0, LAB
+bgt $t1,-100,label	addi $1, $0, VL2	slt $1, $1, RG1	bne $1, $0, LAB
+bgt $t1,100000,label	lui $1, VHL2P1	ori $1, $1, VL2P1U	slt $1, RG1, $1	beq $1, $0, LAB
+bgtu $t1,$t2,label	sltu $1, RG2, RG1	bne $1, $0, LAB
+bgtu $t1,-100,label	addi $1, $0, VL2	sltu $1, $1, RG1	bne $1, $0, LAB
+bgtu $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	sltu $1, $1, RG1	bne $1, $0, LAB
+ble $t1,$t2,label	slt $1, RG2, RG1	beq $1, $0, LAB
+ble $t1,-100,label	addi $1, RG1, -1	slti $1, $1, VL2	bne $1, $0, LAB
+ble $t1,100000,label	lui $1, VHL2P1	ori $1, $1, VL2P1U	slt $1, RG1, $1	bne $1, $0, LAB
+bleu $t1,$t2,label	sltu $1, RG2, RG1	beq $1, $0, LAB
+bleu $t1,-100,label	addi $1, $0, VL2	sltu $1, $1, RG1	beq $1, $0, LAB
+bleu $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	sltu $1, $1, RG1	beq $1, $0, LAB
+blt $t1,$t2,label	slt $1, RG1, RG2	bne $1, $0, LAB
+blt $t1,-100,label	slti $1, RG1, VL2	bne $1, $0, LAB
+blt $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	slt $1, RG1, $1	bne $1, $0, LAB
+bltu $t1,$t2,label	sltu $1, RG1, RG2	bne $1, $0, LAB
+bltu $t1,-100,label	sltiu $1, RG1, VL2	bne $1, $0, LAB
+bltu $t1,100000,label	lui $1, VHL2	ori $1, $1, VL2U	sltu $1, RG1, $1	bne $1, $0, LAB
+
+rol $t1,$t2,$t3	subu $1, $0, RG3	srlv $1, RG2, $1	sllv RG1, RG2, RG3	or RG1, RG1, $1
+rol $t1,$t2,10	srl $1, RG2, S32	sll RG1, RG2, OP3	or RG1, RG1, $1
+ror $t1,$t2,$t3	subu $1, $0, RG3	sllv $1, RG2, $1	srlv RG1, RG2, RG3	or RG1, RG1, $1
+ror $t1,$t2,10	sll $1, RG2, S32	srl RG1, RG2, OP3	or RG1, RG1, $1
+
+mul $t1,$t2,-100	addi $1, $0, VL3	mul RG1, RG2, $1
+mul $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	mul RG1, RG2, $1
+mulu $t1,$t2,$t3	multu RG2, RG3	mflo RG1
+mulu $t1,$t2,-100	addi $1, $0, VL3	multu RG2, $1	mflo RG1
+mulu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	multu RG2, $1	mflo RG1
+mulo $t1,$t2,$t3	mult RG2, RG3	mfhi $1	mflo RG1	sra RG1, RG1, 31	beq $1, RG1, BROFF12	break	mflo RG1
+mulo $t1,$t2,-100	addi $1, $0, VL3	mult RG2, $1	mfhi $1	mflo RG1	sra RG1, RG1, 31	beq $1, RG1, BROFF12	break	mflo RG1
+mulo $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	mult RG2, $1	mfhi $1	mflo RG1	sra RG1, RG1, 31	beq $1, RG1, BROFF12	break	mflo RG1
+mulou $t1,$t2,$t3	multu RG2, RG3	mfhi $1	beq $1, $0, BROFF12	break	mflo RG1
+mulou $t1,$t2,-100	addi $1, $0, VL3	multu RG2, $1	mfhi $1	beq $1, $0, BROFF12	break	mflo RG1
+mulou $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	multu RG2, $1	mfhi $1	beq $1, $0, BROFF12	break	mflo RG1
+div $t1,$t2,$t3	bne RG3, $0, BROFF12	break	div RG2, RG3	mflo RG1
+div $t1,$t2,-100	addi $1, $0, VL3	div RG2, $1	mflo RG1
+div $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	div RG2, $1	mflo RG1
+divu $t1,$t2,$t3	bne RG3, $0, BROFF12	break	divu RG2, RG3	mflo RG1
+divu $t1,$t2,-100	addi $1, $0, VL3	divu RG2, $1	mflo RG1
+divu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	divu RG2, $1	mflo RG1
+rem $t1,$t2,$t3	bne RG3, $0, BROFF12	break	div RG2, RG3	mfhi RG1
+rem $t1,$t2,-100	addi $1, $0, VL3	div RG2, $1	mfhi RG1
+rem $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	div RG2, $1	mfhi RG1
+remu $t1,$t2,$t3	bne RG3, $0, BROFF12	break	divu RG2, RG3	mfhi RG1
+remu $t1,$t2,-100	addi $1, $0, VL3	divu RG2, $1	mfhi RG1
+remu $t1,$t2,100000	lui $1, VHL3	ori $1, $1, VL3U	divu RG2, $1	mfhi RG1
+
+li $t1,-100	addiu RG1, $0, VL2
+li $t1,100	ori RG1, $0, VL2U
+li $t1,100000	lui $1, VHL2	ori RG1, $1, VL2U
+li $t1,label	lui $1, VHL2	ori RG1, $1, VL2U	COMPACT	addi RG1, $0, VL2
+la $t1,($t2)	addi RG1, RG2, 0
+la $t1,-100	addiu RG1, $0, VL2
+la $t1,100	ori RG1, $0, VL2U
+la $t1,100000	lui $1, VHL2	ori RG1, $1, VL2U
+la $t1,100($t2)	ori $1, $0, VL2U	add RG1, RG2, $1
+la $t1,100000($t2)	lui $1, VHL2	ori $1, $1, VL2U	add RG1, RG2, $1
+la $t1,label	lui $1, VHL2	ori RG1, $1, VL2U	COMPACT	addi RG1, $0, VL2
+la $t1,label($t2)	lui $1, VHL2	ori $1, $1, VL2U	add RG1, RG2, $1	COMPACT	addi RG1, RG2, VL2
+la $t1,label+100000	lui $1, VHL2	ori RG1, $1, VL2U
+la $t1,label+100000($t2)	lui $1, VHL2	ori $1, $1, VL2U	add RG1, RG2, $1
+
+ulh $t1,($t2)	lb RG1, 1(RG2)	lbu $1, 0(RG2)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulh $t1,-100($t2)	lui $1, VH2P1	addu $1, $1, RG2	lb RG1, VL2P1($1)	lbu $1, VL2(RG2)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulh $t1,100000	lui $1, VH2P1	lb RG1, VL2P1($1)	lui $1, VH2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulh $t1,label	lui $1, VH2P1	lb RG1, VL2P1($1)	lui $1, VH2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulh $t1,label+100000	lui $1, VH2P1	lb RG1, VL2P1($1)	lui $1, VH2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulh $t1,100000($t2)	lui $1, VH2P1	addu $1, $1, RG2	lb RG1, VL2P1($1)	lui $1, VH2	addu $1, $1, RG2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulh $t1,label($t2)	lui $1, VH2P1	addu $1, $1, RG2	lb RG1, VL2P1($1)	lui $1, VH2	addu $1, $1, RG2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulh $t1,label+100000($t2)	lui $1, VH2P1	addu $1, $1, RG2	lb RG1, VL2P1($1)	lui $1, VH2	addu $1, $1, RG2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,($t2)	lbu RG1, 1(RG2)	lbu $1, 0(RG2)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,-100($t2)	lui $1, VH2P1	addu $1, $1, RG2	lbu RG1, VL2P1($1)	lbu $1, VL2(RG2)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,100000	lui $1, VH2P1	lbu RG1, VL2P1($1)	lui $1, VH2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,label	lui $1, VH2P1	lbu RG1, VL2P1($1)	lui $1, VH2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,label+100000	lui $1, VH2P1	lbu RG1, VL2P1($1)	lui $1, VH2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,100000($t2)	lui $1, VH2P1	addu $1, $1, RG2	lbu RG1, VL2P1($1)	lui $1, VH2	addu $1, $1, RG2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,label($t2)	lui $1, VH2P1	addu $1, $1, RG2	lbu RG1, VL2P1($1)	lui $1, VH2	addu $1, $1, RG2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ulhu $t1,label+100000($t2)	lui $1, VH2P1	addu $1, $1, RG2	lbu RG1, VL2P1($1)	lui $1, VH2	addu $1, $1, RG2	lbu $1, VL2($1)	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,-100($t2)	sb RG1, VL2(RG2)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	lui $1, VH2P1	addu $1, $1, RG2	sb RG1, VL2P1($1)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,100000	lui $1, VH2	sb RG1, VL2($1)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	lui $1, VH2P1	sb RG1, VL2P1($1)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,label	lui $1, VH2	sb RG1, VL2($1)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	lui $1, VH2P1	sb RG1, VL2P1($1)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,label+100000	lui $1, VH2	sb RG1, VL2($1)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	lui $1, VH2P1	sb RG1, VL2P1($1)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,($t2)	sb RG1, 0(RG2)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	sb RG1, 1(RG2)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,100000($t2)	lui $1, VH2	addu $1, $1, RG2	sb RG1, VL2($1)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	lui $1, VH2P1	addu $1, $1, RG2	sb RG1, VL2P1($1)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,label($t2)	lui $1, VH2	addu $1, $1, RG2	sb RG1, VL2($1)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	lui $1, VH2P1	addu $1, $1, RG2	sb RG1, VL2P1($1)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+ush $t1,label+100000($t2)	lui $1, VH2	addu $1, $1, RG2	sb RG1, VL2($1)	sll $1, RG1, 24	srl RG1, RG1, 8	or RG1, RG1, $1	lui $1, VH2P1	addu $1, $1, RG2	sb RG1, VL2P1($1)	srl $1, RG1, 24	sll RG1, RG1, 8	or RG1, RG1, $1
+
+ld $t1,-100($t2)	lw RG1, VL2(RG2)	lui $1, VH2P4	addu $1, $1, RG2	lw NR1, VL2P4($1)
+ld $t1,100000	lui $1, VH2	lw RG1, VL2($1)	lui $1, VH2P4	lw NR1, VL2P4($1)
+ld $t1,label	lui $1, VH2	lw RG1, VL2($1)	lui $1, VH2P4	lw NR1, VL2P4($1)
+ld $t1,label+100000	lui $1, VH2	lw RG1, VL2($1)	lui $1, VH2P4	lw NR1, VL2P4($1)
+ld $t1,($t2)	lw RG1, 0(RG2)	lw NR1, 4(RG2)
+ld $t1,100000($t2)	lui $1, VH2	addu $1, $1, RG2	lw RG1, VL2($1)	lui $1, VH2P4	addu $1, $1, RG2	lw NR1, VL2P4($1)
+ld $t1,label($t2)	lui $1, VH2	addu $1, $1, RG2	lw RG1, VL2($1)	lui $1, VH2P4	addu $1, $1, RG2	lw NR1, VL2P4($1)
+ld $t1,label+100000($t2)	lui $1, VH2	addu $1, $1, RG2	lw RG1, VL2($1)	lui $1, VH2P4	addu $1, $1, RG2	lw NR1, VL2P4($1)
+sd $t1,-100($t2)	sw RG1, VL2(RG2)	lui $1, VH2P4	addu $1, $1, RG2	sw NR1, VL2P4($1)
+sd $t1,100000	lui $1, VH2	sw RG1, VL2($1)	lui $1, VH2P4	sw NR1, VL2P4($1)
+sd $t1,label	lui $1, VH2	sw RG1, VL2($1)	lui $1, VH2P4	sw NR1, VL2P4($1)
+sd $t1,label+100000	lui $1, VH2	sw RG1, VL2($1)	lui $1, VH2P4	sw NR1, VL2P4($1)
+sd $t1,($t2)	sw RG1, 0(RG2)	sw NR1, 4(RG2)
+sd $t1,100000($t2)	lui $1, VH2	addu $1, $1, RG2	sw RG1, VL2($1)	lui $1, VH2P4	addu $1, $1, RG2	sw NR1, VL2P4($1)
+sd $t1,label($t2)	lui $1, VH2	addu $1, $1, RG2	sw RG1, VL2($1)	lui $1, VH2P4	addu $1, $1, RG2	sw NR1, VL2P4($1)
+sd $t1,label+100000($t2)	lui $1, VH2	addu $1, $1, RG2	sw RG1, VL2($1)	lui $1, VH2P4	addu $1, $1, RG2	sw NR1, VL2P4($1)
+`
+
+// memOps 为 MARS 中写法相同的一组访存伪指令，统一生成
+var memOps = []string{"lw", "sw", "lh", "sh", "lb", "sb", "lhu", "lbu", "lwl", "lwr", "swl", "swr"}
+
+const memTable = `
+X $t1,($t2)	X RG1, 0(RG2)
+X $t1,-100	X RG1, VL2($0)
+X $t1,100	ori $1, $0, VL2U	X RG1, 0($1)
+X $t1,100000	lui $1, VH2	X RG1, VL2($1)
+X $t1,100($t2)	ori $1, $0, VL2U	addu $1, $1, RG2	X RG1, 0($1)
+X $t1,100000($t2)	lui $1, VH2	addu $1, $1, RG2	X RG1, VL2($1)
+X $t1,label	lui $1, VH2	X RG1, VL2($1)	COMPACT	X RG1, VL2($0)
+X $t1,label($t2)	lui $1, VH2	addu $1, $1, RG2	X RG1, VL2($1)	COMPACT	X RG1, VL2(RG2)
+X $t1,label+100000	lui $1, VH2	X RG1, VL2($1)
+X $t1,label+100000($t2)	lui $1, VH2	addu $1, $1, RG2	X RG1, VL2($1)
+`
+
+// basicTable 列出与伪指令同名的基本指令写法。MARS 总是先尝试基本指令，
+// 只有操作数不符合基本指令格式时才按伪指令展开。
+var basicTable = `
+add $t1,$t2,$t3
+addu $t1,$t2,$t3
+sub $t1,$t2,$t3
+subu $t1,$t2,$t3
+and $t1,$t2,$t3
+or $t1,$t2,$t3
+xor $t1,$t2,$t3
+addi $t1,$t2,-100
+addiu $t1,$t2,-100
+andi $t1,$t2,100
+ori $t1,$t2,100
+xori $t1,$t2,100
+beq $t1,$t2,label
+bne $t1,$t2,label
+mul $t1,$t2,$t3
+div $t1,$t2
+divu $t1,$t2
+lw $t1,-100($t2)
+sw $t1,-100($t2)
+lh $t1,-100($t2)
+sh $t1,-100($t2)
+lb $t1,-100($t2)
+sb $t1,-100($t2)
+lhu $t1,-100($t2)
+lbu $t1,-100($t2)
+lwl $t1,-100($t2)
+lwr $t1,-100($t2)
+swl $t1,-100($t2)
+swr $t1,-100($t2)
+`
+
+func init() {
+	load(forms, table)
+	for _, op := range memOps {
+		load(forms, strings.ReplaceAll(memTable, "X", op))
+	}
+	load(basics, basicTable)
+}
+
+func load(dst map[string][]*Form, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		op, ops := splitStatement(cols[0])
+		f := &Form{Op: op}
+		for _, o := range ops {
+			f.Operands = append(f.Operands, specOperand(o))
+		}
+		dst[op] = append(dst[op], f)
+		compact := false
+		for _, t := range cols[1:] {
+			switch {
+			case t == "COMPACT":
+				compact = true
+			case compact:
+				f.Compact = append(f.Compact, t)
+			default:
+				f.Templates = append(f.Templates, t)
+			}
+		}
+	}
+}
+
+func splitStatement(s string) (string, []string) {
+	s = strings.TrimSpace(s)
+	op := s
+	rest := ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		op, rest = s[:i], strings.TrimSpace(s[i+1:])
+	}
+	var ops []string
+	if rest != "" {
+		for _, o := range strings.Split(rest, ",") {
+			ops = append(ops, strings.TrimSpace(o))
+		}
+	}
+	return strings.ToLower(op), ops
+}
+
+// specOperand 把表中的示例操作数转换为类别：10/-100/100/100000 分别代表
+// 5 位、有符号 16 位、无符号 16 位与 32 位立即数
+func specOperand(s string) Operand {
+	op := Operand{Text: s, Off: s}
+	if i := strings.Index(s, "("); i >= 0 {
+		op.Mem = true
+		op.Off = s[:i]
+		op.Base = strings.TrimSuffix(s[i+1:], ")")
+	}
+	switch op.Off {
+	case "":
+		op.Class = None
+	case "$t1", "$t2", "$t3":
+		op.Class = Reg
+	case "10":
+		op.Class = Imm5
+	case "-100":
+		op.Class = Imm16
+	case "100":
+		op.Class = Imm16U
+	case "100000":
+		op.Class = Imm32
+	case "label":
+		op.Class = Label
+	case "label+100000":
+		op.Class = LabelOff
+	default:
+		panic("pseudo: 无法识别的示例操作数 " + s)
+	}
+	return op
+}
+
+var (
+	identRe    = regexp.MustCompile(`^[A-Za-z_\.][A-Za-z0-9_\.\$]*$`)
+	labelOffRe = regexp.MustCompile(`^([A-Za-z_\.][A-Za-z0-9_\.\$]*)\s*[+-]\s*(0[xX][0-9a-fA-F]+|[0-9]+)$`)
+)
+
+// Classify 按 MARS 规则判定源操作数的类别。标签与 标签±常数 保持 MARS 的标签类别，
+// 其余表达式求值后按值分类；sym 用于查询符号地址，符号尚未确定时按 5 位立即数估计，
+// 由汇编器在符号地址确定后重新分类。
+func Classify(s string, sym func(string) (uint32, bool)) Operand {
+	s = strings.TrimSpace(s)
+	op := Operand{Text: s, Off: s}
+	if strings.HasSuffix(s, ")") {
+		if i := strings.LastIndex(s, "("); i >= 0 && strings.HasPrefix(strings.TrimSpace(s[i+1:]), "$") {
+			op.Mem = true
+			op.Off = strings.TrimSpace(s[:i])
+			op.Base = strings.TrimSpace(s[i+1 : len(s)-1])
+		}
+	}
+	off := op.Off
+	switch {
+	case off == "":
+		if op.Mem {
+			op.Class = None
+		} else {
+			op.Class = Unknown
+		}
+	case strings.HasPrefix(off, "$"):
+		op.Class = Reg
+	case identRe.MatchString(off):
+		op.Class = Label
+	case labelOffRe.MatchString(off):
+		op.Class = LabelOff
+	default:
+		u, err := expr.Eval(off, sym)
+		if errors.Is(err, expr.ErrUndefined) {
+			op.Class = Imm5
+			break
+		}
+		if errors.Is(err, lexer.ErrRange) {
+			// 仍按立即数匹配写法，由展开时报告超出范围
+			op.Class = Imm32
+			break
+		}
+		if err != nil {
+			op.Class, op.Err = Unknown, err
+			break
+		}
+		v := int32(u)
+		op.Value = v
+		switch {
+		case v >= 0 && v <= 31:
+			op.Class = Imm5
+		case v >= 0 && v <= 0xffff:
+			op.Class = Imm16U
+		case v >= -0x8000 && v < 0:
+			op.Class = Imm16
+		default:
+			op.Class = Imm32
+		}
+	}
+	return op
+}
+
+// match 判断源操作数是否符合写法中的操作数类别（整数可放宽到更宽的类别）
+func match(spec, cand Operand) bool {
+	if spec.Mem != cand.Mem {
+		return false
+	}
+	if spec.Class == cand.Class {
+		return true
+	}
+	switch spec.Class {
+	case Imm32:
+		return cand.Class == Imm5 || cand.Class == Imm16 || cand.Class == Imm16U
+	case Imm16:
+		return cand.Class == Imm5 || (cand.Class == Imm16U && cand.Value <= 0x7fff)
+	case Imm16U:
+		return cand.Class == Imm5
+	}
+	return false
+}
+
+func matchAll(f *Form, ops []Operand) bool {
+	if len(f.Operands) != len(ops) {
+		return false
+	}
+	for i := range ops {
+		if !match(f.Operands[i], ops[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Known 报告 op（小写）是否为伪指令助记符
+func Known(op string) bool {
+	_, ok := forms[op]
+	return ok
+}
+
+// Lookup 返回与语句匹配的伪指令写法及其操作数；若语句应按基本指令汇编则返回 nil。
+// 没有写法匹配时仍返回各操作数，供调用者用 OperandErr 报告求值错误。
+// toks 为助记符与各操作数，sym 同 Classify。
+func Lookup(toks []string, sym func(string) (uint32, bool)) (*Form, []Operand) {
+	if len(toks) == 0 {
+		return nil, nil
+	}
+	op := strings.ToLower(toks[0])
+	candidates, ok := forms[op]
+	if !ok {
+		return nil, nil
+	}
+	ops := make([]Operand, 0, len(toks)-1)
+	for _, a := range toks[1:] {
+		ops = append(ops, Classify(a, sym))
+	}
+	for _, b := range basics[op] {
+		if matchAll(b, ops) {
+			return nil, nil
+		}
+	}
+	for _, f := range candidates {
+		if matchAll(f, ops) {
+			return f, ops
+		}
+	}
+	return nil, ops
+}
+
+// OperandErr 返回第一个求值失败的操作数的错误，没有则返回 nil
+func OperandErr(ops []Operand) error {
+	for _, op := range ops {
+		if op.Err != nil {
+			return diag.Tok(op.Off, op.Err)
+		}
+	}
+	return nil
+}
+
+// Size 返回语句在符号地址未知时估计的最小字节数；基本指令为 4。
+// 带标签的写法先按紧凑展开估计，由汇编器在标签地址确定后放宽。
+func Size(toks []string) uint32 {
+	if f, _ := Lookup(toks, nil); f != nil {
+		return f.Size(len(f.Compact) > 0)
+	}
+	return 4
+}
+
+// Size 返回该写法展开后的字节数
+func (f *Form) Size(compact bool) uint32 {
+	if compact && len(f.Compact) > 0 {
+		return uint32(len(f.Compact) * 4)
+	}
+	return uint32(len(f.Templates) * 4)
+}
+
+// Fits 判断紧凑展开能否容纳操作数的值。紧凑模板只引用标签操作数，
+// 其地址需能作为有符号 16 位偏移使用。
+func (f *Form) Fits(ops []Operand, eval func(string) (uint32, error)) (bool, error) {
+	if len(f.Compact) == 0 {
+		return false, nil
+	}
+	for i, spec := range f.Operands {
+		if spec.Class != Label {
+			continue
+		}
+		v, err := eval(ops[i].Off)
+		if err != nil {
+			return false, err
+		}
+		if int32(v) < -0x8000 || int32(v) > 0x7fff {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+var codeRe = regexp.MustCompile(`(RG|NR|OP)(\d)|(VHL|VH|VL)(\d)(?:P(\d))?(U?)|LAB|S32|BROFF12`)
+
+// Expand 按模板展开为基本指令的 token 列表。eval 用于求取立即数或标签表达式的值；
+// compact 为真且存在紧凑模板时使用紧凑展开。
+func (f *Form) Expand(ops []Operand, eval func(string) (uint32, error), compact bool) ([][]string, error) {
+	var out [][]string
+	var firstErr error
+	templates := f.Templates
+	if compact && len(f.Compact) > 0 {
+		templates = f.Compact
+	}
+	for _, tmpl := range templates {
+		// 模板本身不含空白，先拆分再替换，以免操作数原文中的逗号或空白被拆开
+		toks := strings.Fields(strings.ReplaceAll(tmpl, ",", " "))
+		for i, t := range toks {
+			toks[i] = codeRe.ReplaceAllStringFunc(t, func(code string) string {
+				s, err := substitute(code, ops, eval)
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				return s
+			})
+		}
+		out = append(out, toks)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
+
+// Ref 是展开结果中一处取自操作数值的 16 位字段
+type Ref struct {
+	Line int    // 展开后的第几条指令
+	Code string // VL（低 16 位）、VH（进位修正的高 16 位）或 VHL（高 16 位）
+	Expr string // 取值的表达式，含模板中的附加偏移
+}
+
+// Refs 列出按 compact 展开时各条指令中取自操作数值的字段，
+// 生成可重定位目标文件时据此为引用标签的字段记录重定位
+func (f *Form) Refs(ops []Operand, compact bool) []Ref {
+	var out []Ref
+	templates := f.Templates
+	if compact && len(f.Compact) > 0 {
+		templates = f.Compact
+	}
+	for i, tmpl := range templates {
+		for _, m := range codeRe.FindAllStringSubmatch(tmpl, -1) {
+			if m[3] == "" {
+				continue
+			}
+			n, _ := strconv.Atoi(m[4])
+			if n < 1 || n > len(ops) {
+				continue
+			}
+			e := ops[n-1].Off
+			if m[5] != "" {
+				e = "(" + e + ")+" + m[5]
+			}
+			out = append(out, Ref{Line: i, Code: m[3], Expr: e})
+		}
+	}
+	return out
+}
+
+func substitute(code string, ops []Operand, eval func(string) (uint32, error)) (string, error) {
+	m := codeRe.FindStringSubmatch(code)
+	operand := func(d string) (Operand, error) {
+		n, _ := strconv.Atoi(d)
+		if n < 1 || n > len(ops) {
+			return Operand{}, fmt.Errorf("模板引用了不存在的操作数 %d", n)
+		}
+		return ops[n-1], nil
+	}
+	switch {
+	case code == "LAB":
+		return ops[len(ops)-1].Text, nil
+	case code == "BROFF12":
+		return "1", nil
+	case code == "S32":
+		v, err := eval(ops[len(ops)-1].Text)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(32 - v)), nil
+	case m[1] != "":
+		o, err := operand(m[2])
+		if err != nil {
+			return "", err
+		}
+		switch m[1] {
+		case "OP":
+			return o.Text, nil
+		case "NR":
+			return nextReg(o.Text)
+		}
+		if o.Mem {
+			return o.Base, nil
+		}
+		return o.Text, nil
+	default:
+		o, err := operand(m[4])
+		if err != nil {
+			return "", err
+		}
+		v, err := eval(o.Off)
+		if err != nil {
+			return "", err
+		}
+		if m[5] != "" {
+			p, _ := strconv.Atoi(m[5])
+			v += uint32(p)
+		}
+		lo := v & 0xffff
+		switch m[3] {
+		case "VL":
+			if m[6] == "U" {
+				return strconv.Itoa(int(lo)), nil
+			}
+			return strconv.Itoa(int(int16(lo))), nil
+		case "VH":
+			hi := v >> 16
+			if lo&0x8000 != 0 {
+				hi = (hi + 1) & 0xffff
+			}
+			return strconv.Itoa(int(hi)), nil
+		default: // VHL
+			return strconv.Itoa(int(v >> 16)), nil
+		}
+	}
+}
+
+var regNames = []string{
+	"$zero", "$at", "$v0", "$v1", "$a0", "$a1", "$a2", "$a3",
+	"$t0", "$t1", "$t2", "$t3", "$t4", "$t5", "$t6", "$t7",
+	"$s0", "$s1", "$s2", "$s3", "$s4", "$s5", "$s6", "$s7",
+	"$t8", "$t9", "$k0", "$k1", "$gp", "$sp", "$fp", "$ra",
+}
+
+// nextReg 返回编号加 1 的寄存器，用于 ld/sd
+func nextReg(r string) (string, error) {
+	for i, n := range regNames {
+		if n == r || fmt.Sprintf("$%d", i) == r {
+			if i == 31 {
+				break
+			}
+			return fmt.Sprintf("$%d", i+1), nil
+		}
+	}
+	return "", fmt.Errorf("寄存器 %s 没有下一个寄存器", r)
+}
@@ -2,27 +2,26 @@ package regs
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
+
+	"mips2hex/diag"
 )
 
-// RegOf 将寄存器 token 映射到数字（0-31），否则直接报错并退出
-func RegOf(tok string, lineNo int) int {
+// RegOf 将寄存器 token 映射到数字（0-31），无法识别时返回错误
+func RegOf(tok string) (int, error) {
 	s := strings.TrimSpace(tok)
 	s = strings.TrimSuffix(s, ",")
 	if v, ok := regMap[s]; ok {
-		return v
+		return v, nil
 	}
 	// 支持 $12 数字格式
 	if strings.HasPrefix(s, "$") {
 		if n, err := strconv.Atoi(s[1:]); err == nil && n >= 0 && n <= 31 {
-			return n
+			return n, nil
 		}
 	}
-	fmt.Fprintf(os.Stderr, "无法识别的寄存器 '%s' 在第 %d 行\n", s, lineNo)
-	os.Exit(1)
-	return 0
+	return 0, diag.Tok(s, fmt.Errorf("无法识别的寄存器 '%s'", s))
 }
 
 var regMap = map[string]int{
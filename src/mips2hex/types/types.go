@@ -1,32 +1,88 @@
 package types
 
+import (
+	"fmt"
+
+	"mips2hex/diag"
+)
+
 type ItemKind int
 
 const (
 	Instr ItemKind = iota
 	Word
+	Half
+	Byte
+	Bytes // .ascii/.asciiz/.space/.align 填充等解析时即可确定内容的数据
+)
+
+// Segment 表示 item 或标签所在的段
+type Segment int
+
+const (
+	Text Segment = iota
+	Data
 )
 
 type Item struct {
 	Kind     ItemKind
+	Seg      Segment
 	Raw      string   // 清理过注释和空白的原始文本
 	Tokens   []string // tokenized
+	File     string   // 所在文件，由 .include 引入或经 ParseFile 解析时设置
 	LineNo   int
 	OrigLine string
 	Size     uint32
+	Addr     uint32     // 段内偏移
+	Bytes    []byte     // Kind 为 Bytes 时的内容
+	Align    uint32     // .align 产生的填充 item 的对齐字节数，汇编器调整指令长度后据此重算填充
+	Macro    *MacroCall // 由宏展开得到时指向调用处，LineNo 为宏体中的行号
 }
 
-type InstrType int
+// Diag 把与 item 相关的错误转换为诊断，宏展开的调用链作为附加说明
+func (it Item) Diag(sev diag.Severity, err error) diag.Diagnostic {
+	col, span := diag.Locate(it.OrigLine, err)
+	d := diag.Diagnostic{
+		File:     it.File,
+		Line:     it.LineNo,
+		Col:      col,
+		Span:     span,
+		Severity: sev,
+		Message:  err.Error(),
+		Source:   it.OrigLine,
+	}
+	for m := it.Macro; m != nil; m = m.Parent {
+		mcol, _ := diag.Locate(m.Source, nil)
+		d.Notes = append(d.Notes, diag.Diagnostic{
+			File:     m.File,
+			Line:     m.LineNo,
+			Col:      mcol,
+			Severity: diag.Note,
+			Message:  fmt.Sprintf("由此处调用的宏 %s 展开", m.Name),
+			Source:   m.Source,
+		})
+	}
+	return d
+}
 
-const (
-	RType InstrType = iota
-	IType
-	JType
-	Special
-)
+// MacroCall 记录一次宏展开的调用处，嵌套调用通过 Parent 串联
+type MacroCall struct {
+	Name   string
+	File   string
+	LineNo int
+	Source string // 调用处的源码行
+	Parent *MacroCall
+}
 
-type Instruction struct {
-	Type   InstrType
-	Opcode uint32
-	Funct  uint32
+// Symbol 记录标签所在的段与段内偏移，段基址在汇编时才确定
+type Symbol struct {
+	Seg    Segment
+	Addr   uint32
+	Item   int  // 标签之后第一个 item 的下标，汇编器调整指令长度后据此重算 Addr
+	Global bool // 由 .globl 导出，链接时可被其他文件引用
+	Extern bool // 由 .extern（或 .globl 未定义的符号）声明、定义在其他文件中，Seg/Addr 无意义
+	// 定义所在的源码行，用于诊断
+	File   string
+	LineNo int
+	Source string
 }
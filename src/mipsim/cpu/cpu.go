@@ -3,15 +3,22 @@ package cpu
 import (
 	"fmt"
 	"hex2mips/disassembler"
+	"isa"
+	"memcfg"
 )
 
 type CPU struct {
-	PC       uint32
-	Regs     [32]uint32
-	Mem      map[uint32]uint32
-	Hi, Lo   uint32
-	NextPC   uint32
-	MaxSteps int // 最大执行步数限制，防止死循环
+	PC     uint32
+	Regs   [32]uint32
+	Mem    map[uint32]uint32
+	Hi, Lo uint32
+	CP0    [32]uint32 // 协处理器 0 寄存器，用到 SR(12)、Cause(13)、EPC(14)
+	NextPC uint32
+	// ExcVector 为异常入口地址，syscall、break 与自陷发生时跳转到此处
+	ExcVector uint32
+	MaxSteps  int // 最大执行步数限制，防止死循环
+	// Annotate 非空时，跟踪输出中每条指令后附上其返回的说明（如源码行），返回空串时不输出
+	Annotate func(pc uint32) string
 }
 
 type ExecResult struct {
@@ -21,10 +28,28 @@ type ExecResult struct {
 	MemWrite     bool
 	MemDest      uint32
 	MemWriteData uint32
+	Exception    bool
+	ExcCode      uint32 // Cause.ExcCode：8 syscall，9 break，13 自陷
 }
 
+// New 按课程 CPU 的布局（PC 从 0x3000 开始，寄存器全为 0）创建 CPU
 func New() *CPU {
-	return &CPU{PC: 0x3000, Regs: [32]uint32{}, Mem: make(map[uint32]uint32), MaxSteps: 10000}
+	return NewConfig(memcfg.Course)
+}
+
+// NewConfig 按内存布局 cfg 设置 PC、$gp 与 $sp 的初值
+func NewConfig(cfg memcfg.Config) *CPU {
+	c := &CPU{PC: cfg.TextBase, Regs: [32]uint32{}, Mem: make(map[uint32]uint32), MaxSteps: 10000, ExcVector: cfg.ExcHandler}
+	c.Regs[28] = cfg.GP
+	c.Regs[29] = cfg.SP
+	return c
+}
+
+// LoadData 把数据段镜像（每个元素一个大端序字）装入从 base 开始的内存
+func (c *CPU) LoadData(base uint32, words []uint32) {
+	for i, w := range words {
+		c.Mem[base+uint32(i*4)] = w
+	}
 }
 
 func signExtend16(x uint32) uint32 {
@@ -54,6 +79,11 @@ func (c *CPU) Run(instrs []uint32) {
 		asm := disassembler.DecodeWord(word, c.PC)
 		res := c.Execute(word)
 		fmt.Printf("Instr: 0x%08x   %s\n", word, asm)
+		if c.Annotate != nil {
+			if note := c.Annotate(c.PC); note != "" {
+				fmt.Printf("Source : %s\n", note)
+			}
+		}
 		fmt.Printf("PC : 0x%08x\n", c.PC)
 		if res.RegWrite {
 			fmt.Printf("RegWrite : 1\n")
@@ -73,20 +103,25 @@ func (c *CPU) Run(instrs []uint32) {
 			fmt.Printf("MemDest : 0x00000000\n")
 			fmt.Printf("MemWriteData : 0x00000000\n")
 		}
+		if res.Exception {
+			fmt.Printf("Exception : %d (%s), EPC=0x%08x -> 0x%08x\n", res.ExcCode, excName(res.ExcCode), c.CP0[14], c.ExcVector)
+		}
 		c.PC = c.NextPC
 	}
 }
 
-func regName(n uint32) string {
-	names := []string{
-		"$zero", "$at", "$v0", "$v1",
-		"$a0", "$a1", "$a2", "$a3",
-		"$t0", "$t1", "$t2", "$t3", "$t4", "$t5", "$t6", "$t7",
-		"$s0", "$s1", "$s2", "$s3", "$s4", "$s5", "$s6", "$s7",
-		"$t8", "$t9", "$k0", "$k1", "$gp", "$sp", "$fp", "$ra",
-	}
-	if n < 32 {
-		return names[n]
+func excName(code uint32) string {
+	switch code {
+	case excSyscall:
+		return "Sys"
+	case excBreak:
+		return "Bp"
+	case excTrap:
+		return "Tr"
 	}
-	return fmt.Sprintf("$r%d", n)
+	return "?"
+}
+
+func regName(n uint32) string {
+	return isa.RegName(n)
 }
@@ -1,360 +1,324 @@
 package cpu
 
-func (c *CPU) Execute(instrHex uint32) ExecResult {
-	opcode := instrHex >> 26
-	rs := (instrHex >> 21) & 0x1F
-	rt := (instrHex >> 16) & 0x1F
-	rd := (instrHex >> 11) & 0x1F
-	shamt := (instrHex >> 6) & 0x1F
-	funct := instrHex & 0x3F
-	imm := instrHex & 0xFFFF
-	immSe := signExtend16(imm)
-	addr := instrHex & 0x03FFFFFF
+import (
+	"math/bits"
 
-	res := ExecResult{}
+	"isa"
+)
 
-	defer func() { c.Regs[0] = 0 }()
+// 异常码（Cause.ExcCode）
+const (
+	excSyscall = 8
+	excBreak   = 9
+	excTrap    = 13
+)
 
-	switch opcode {
-	case 0x00: // R-type
-		switch funct {
-		case 0x20: // add
-			c.Regs[rd] = uint32(int32(c.Regs[rs]) + int32(c.Regs[rt]))
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x21: // addu
-			c.Regs[rd] = c.Regs[rs] + c.Regs[rt]
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x22: // sub
-			c.Regs[rd] = uint32(int32(c.Regs[rs]) - int32(c.Regs[rt]))
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x23: // subu
-			c.Regs[rd] = c.Regs[rs] - c.Regs[rt]
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x24: // and
-			c.Regs[rd] = c.Regs[rs] & c.Regs[rt]
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x25: // or
-			c.Regs[rd] = c.Regs[rs] | c.Regs[rt]
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x26: // xor
-			c.Regs[rd] = c.Regs[rs] ^ c.Regs[rt]
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x27: // nor
-			c.Regs[rd] = ^(c.Regs[rs] | c.Regs[rt])
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x00: // sll
-			c.Regs[rd] = c.Regs[rt] << shamt
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x02: // srl
-			c.Regs[rd] = c.Regs[rt] >> shamt
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x03: // sra
-			c.Regs[rd] = uint32(int32(c.Regs[rt]) >> shamt)
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x04: // sllv
-			c.Regs[rd] = c.Regs[rt] << (c.Regs[rs] & 0x1F)
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x06: // srlv
-			c.Regs[rd] = c.Regs[rt] >> (c.Regs[rs] & 0x1F)
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x07: // srav
-			c.Regs[rd] = uint32(int32(c.Regs[rt]) >> (c.Regs[rs] & 0x1F))
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x08: // jr
-			c.NextPC = c.Regs[rs]
-		case 0x09: // jalr
-			c.Regs[rd] = c.PC + 8
-			c.NextPC = c.Regs[rs]
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x10: // mfhi
-			c.Regs[rd] = c.Hi
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x11: // mthi
-			c.Hi = c.Regs[rs]
-		case 0x12: // mflo
-			c.Regs[rd] = c.Lo
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x13: // mtlo
-			c.Lo = c.Regs[rs]
-		case 0x18: // mult
-			val := int64(int32(c.Regs[rs])) * int64(int32(c.Regs[rt]))
-			c.Hi = uint32(val >> 32)
-			c.Lo = uint32(val & 0xFFFFFFFF)
-		case 0x19: // multu
-			val := uint64(c.Regs[rs]) * uint64(c.Regs[rt])
-			c.Hi = uint32(val >> 32)
-			c.Lo = uint32(val & 0xFFFFFFFF)
-		case 0x1A: // div
-			if c.Regs[rt] != 0 {
-				c.Lo = uint32(int32(c.Regs[rs]) / int32(c.Regs[rt]))
-				c.Hi = uint32(int32(c.Regs[rs]) % int32(c.Regs[rt]))
-			}
-		case 0x1B: // divu
-			if c.Regs[rt] != 0 {
-				c.Lo = c.Regs[rs] / c.Regs[rt]
-				c.Hi = c.Regs[rs] % c.Regs[rt]
-			}
-		case 0x2a: // slt
-			if int32(c.Regs[rs]) < int32(c.Regs[rt]) {
-				c.Regs[rd] = 1
-			} else {
-				c.Regs[rd] = 0
-			}
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		case 0x2b: // sltu
-			if c.Regs[rs] < c.Regs[rt] {
-				c.Regs[rd] = 1
-			} else {
-				c.Regs[rd] = 0
-			}
-			if rd != 0 {
-				res.RegWrite = true
-				res.RegDest = rd
-				res.RegWriteData = c.Regs[rd]
-			}
-		}
-	case 0x02: // j
-		c.NextPC = (c.PC & 0xF0000000) | (addr << 2)
-	case 0x03: // jal
-		c.Regs[31] = c.PC + 4
-		c.NextPC = (c.PC & 0xF0000000) | (addr << 2)
+// raise 产生异常：EPC 记录当前指令地址，Cause 记录异常码，置 SR.EXL 并跳转到异常入口
+func (c *CPU) raise(res *ExecResult, code uint32) {
+	c.CP0[14] = c.PC
+	c.CP0[13] = c.CP0[13]&^0x7c | code<<2
+	c.CP0[12] |= 0x2
+	c.NextPC = c.ExcVector
+	res.Exception = true
+	res.ExcCode = code
+}
+
+// trap 在 cond 成立时产生自陷异常
+func (c *CPU) trap(res *ExecResult, cond bool) {
+	if cond {
+		c.raise(res, excTrap)
+	}
+}
+
+// setReg 写通用寄存器并记录写入，$zero 的写入被忽略
+func (c *CPU) setReg(res *ExecResult, r, v uint32) {
+	c.Regs[r] = v
+	if r != 0 {
 		res.RegWrite = true
-		res.RegDest = 31
-		res.RegWriteData = c.Regs[31]
-	case 0x08: // addi
-		c.Regs[rt] = uint32(int32(c.Regs[rs]) + int32(immSe))
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x09: // addiu
-		c.Regs[rt] = c.Regs[rs] + immSe
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x0C: // andi
-		c.Regs[rt] = c.Regs[rs] & imm
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x0D: // ori
-		c.Regs[rt] = c.Regs[rs] | imm
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x0E: // xori
-		c.Regs[rt] = c.Regs[rs] ^ imm
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x0F: // lui
-		c.Regs[rt] = imm << 16
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x04: // beq
-		if c.Regs[rs] == c.Regs[rt] {
-			c.NextPC = c.PC + 4 + (immSe << 2)
-		}
-	case 0x05: // bne
-		if c.Regs[rs] != c.Regs[rt] {
-			c.NextPC = c.PC + 4 + (immSe << 2)
+		res.RegDest = r
+		res.RegWriteData = v
+	}
+}
+
+// store 写内存字并记录写入，addr 与 data 为跟踪中报告的地址与数据
+func (c *CPU) store(res *ExecResult, word, v, addr, data uint32) {
+	c.Mem[word] = v
+	res.MemWrite = true
+	res.MemDest = addr
+	res.MemWriteData = data
+}
+
+// hilo 返回 HI:LO 组成的 64 位值，setHilo 写回
+func (c *CPU) hilo() uint64 { return uint64(c.Hi)<<32 | uint64(c.Lo) }
+
+func (c *CPU) setHilo(v uint64) { c.Hi, c.Lo = uint32(v>>32), uint32(v) }
+
+// branch 在 cond 成立时跳转到 PC+4+offset
+func (c *CPU) branch(f isa.Fields, cond bool) {
+	if cond {
+		c.NextPC = c.PC + 4 + (signExtend16(f.Imm) << 2)
+	}
+}
+
+// ea 返回访存指令的有效地址
+func (c *CPU) ea(f isa.Fields) uint32 {
+	return c.Regs[f.Rs] + signExtend16(f.Imm)
+}
+
+func b2u(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// semantics 是每条指令的执行语义，按 isa 表中的助记符索引
+var semantics = map[string]func(c *CPU, f isa.Fields, res *ExecResult){
+	"nop": func(c *CPU, f isa.Fields, res *ExecResult) {},
+
+	// 算术逻辑
+	"add": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rd, uint32(int32(c.Regs[f.Rs])+int32(c.Regs[f.Rt])))
+	},
+	"addu": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rs]+c.Regs[f.Rt]) },
+	"sub": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rd, uint32(int32(c.Regs[f.Rs])-int32(c.Regs[f.Rt])))
+	},
+	"subu": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rs]-c.Regs[f.Rt]) },
+	"and":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rs]&c.Regs[f.Rt]) },
+	"or":   func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rs]|c.Regs[f.Rt]) },
+	"xor":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rs]^c.Regs[f.Rt]) },
+	"nor":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, ^(c.Regs[f.Rs] | c.Regs[f.Rt])) },
+	"slt": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rd, b2u(int32(c.Regs[f.Rs]) < int32(c.Regs[f.Rt])))
+	},
+	"sltu": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, b2u(c.Regs[f.Rs] < c.Regs[f.Rt])) },
+	"sll":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rt]<<f.Shamt) },
+	"srl":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rt]>>f.Shamt) },
+	"sra":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, uint32(int32(c.Regs[f.Rt])>>f.Shamt)) },
+	"sllv": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rt]<<(c.Regs[f.Rs]&0x1F)) },
+	"srlv": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Regs[f.Rt]>>(c.Regs[f.Rs]&0x1F)) },
+	"srav": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rd, uint32(int32(c.Regs[f.Rt])>>(c.Regs[f.Rs]&0x1F)))
+	},
+	"movz": func(c *CPU, f isa.Fields, res *ExecResult) {
+		if c.Regs[f.Rt] == 0 {
+			c.setReg(res, f.Rd, c.Regs[f.Rs])
 		}
-	case 0x06: // blez
-		if int32(c.Regs[rs]) <= 0 {
-			c.NextPC = c.PC + 4 + (immSe << 2)
+	},
+	"movn": func(c *CPU, f isa.Fields, res *ExecResult) {
+		if c.Regs[f.Rt] != 0 {
+			c.setReg(res, f.Rd, c.Regs[f.Rs])
 		}
-	case 0x07: // bgtz
-		if int32(c.Regs[rs]) > 0 {
-			c.NextPC = c.PC + 4 + (immSe << 2)
+	},
+	"clz": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rd, uint32(bits.LeadingZeros32(c.Regs[f.Rs])))
+	},
+	"clo": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rd, uint32(bits.LeadingZeros32(^c.Regs[f.Rs])))
+	},
+	"mul": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rd, uint32(int32(c.Regs[f.Rs])*int32(c.Regs[f.Rt])))
+	},
+
+	"addi": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rt, uint32(int32(c.Regs[f.Rs])+int32(signExtend16(f.Imm))))
+	},
+	"addiu": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rt, c.Regs[f.Rs]+signExtend16(f.Imm)) },
+	"andi":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rt, c.Regs[f.Rs]&f.Imm) },
+	"ori":   func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rt, c.Regs[f.Rs]|f.Imm) },
+	"xori":  func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rt, c.Regs[f.Rs]^f.Imm) },
+	"lui":   func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rt, f.Imm<<16) },
+	"slti": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rt, b2u(int32(c.Regs[f.Rs]) < int32(signExtend16(f.Imm))))
+	},
+	"sltiu": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setReg(res, f.Rt, b2u(c.Regs[f.Rs] < signExtend16(f.Imm)))
+	},
+
+	// HI/LO
+	"mfhi": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Hi) },
+	"mflo": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rd, c.Lo) },
+	"mthi": func(c *CPU, f isa.Fields, res *ExecResult) { c.Hi = c.Regs[f.Rs] },
+	"mtlo": func(c *CPU, f isa.Fields, res *ExecResult) { c.Lo = c.Regs[f.Rs] },
+	"mult": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setHilo(uint64(int64(int32(c.Regs[f.Rs])) * int64(int32(c.Regs[f.Rt]))))
+	},
+	"multu": func(c *CPU, f isa.Fields, res *ExecResult) { c.setHilo(uint64(c.Regs[f.Rs]) * uint64(c.Regs[f.Rt])) },
+	"div": func(c *CPU, f isa.Fields, res *ExecResult) {
+		if c.Regs[f.Rt] != 0 {
+			c.Lo = uint32(int32(c.Regs[f.Rs]) / int32(c.Regs[f.Rt]))
+			c.Hi = uint32(int32(c.Regs[f.Rs]) % int32(c.Regs[f.Rt]))
 		}
-	case 0x01: // REGIMM
-		switch rt {
-		case 0x00: // bltz
-			if int32(c.Regs[rs]) < 0 {
-				c.NextPC = c.PC + 4 + (immSe << 2)
-			}
-		case 0x01: // bgez
-			if int32(c.Regs[rs]) >= 0 {
-				c.NextPC = c.PC + 4 + (immSe << 2)
-			}
+	},
+	"divu": func(c *CPU, f isa.Fields, res *ExecResult) {
+		if c.Regs[f.Rt] != 0 {
+			c.Lo = c.Regs[f.Rs] / c.Regs[f.Rt]
+			c.Hi = c.Regs[f.Rs] % c.Regs[f.Rt]
 		}
-	case 0x20: // lb
-		addrCalc := c.Regs[rs] + immSe
-		val := c.Mem[addrCalc&^3] >> ((3 - (addrCalc % 4)) * 8) & 0xFF
+	},
+	"madd": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setHilo(c.hilo() + uint64(int64(int32(c.Regs[f.Rs]))*int64(int32(c.Regs[f.Rt]))))
+	},
+	"maddu": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setHilo(c.hilo() + uint64(c.Regs[f.Rs])*uint64(c.Regs[f.Rt]))
+	},
+	"msub": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setHilo(c.hilo() - uint64(int64(int32(c.Regs[f.Rs]))*int64(int32(c.Regs[f.Rt]))))
+	},
+	"msubu": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.setHilo(c.hilo() - uint64(c.Regs[f.Rs])*uint64(c.Regs[f.Rt]))
+	},
+
+	// 跳转与分支
+	"j":  func(c *CPU, f isa.Fields, res *ExecResult) { c.NextPC = (c.PC & 0xF0000000) | (f.Target << 2) },
+	"jr": func(c *CPU, f isa.Fields, res *ExecResult) { c.NextPC = c.Regs[f.Rs] },
+	"jal": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.NextPC = (c.PC & 0xF0000000) | (f.Target << 2)
+		c.Regs[31] = c.PC + 4
+		res.RegWrite = true
+		res.RegDest = 31
+		res.RegWriteData = c.Regs[31]
+	},
+	"jalr": func(c *CPU, f isa.Fields, res *ExecResult) {
+		target := c.Regs[f.Rs]
+		c.setReg(res, f.Rd, c.PC+8)
+		c.NextPC = target
+	},
+	"beq":  func(c *CPU, f isa.Fields, res *ExecResult) { c.branch(f, c.Regs[f.Rs] == c.Regs[f.Rt]) },
+	"bne":  func(c *CPU, f isa.Fields, res *ExecResult) { c.branch(f, c.Regs[f.Rs] != c.Regs[f.Rt]) },
+	"blez": func(c *CPU, f isa.Fields, res *ExecResult) { c.branch(f, int32(c.Regs[f.Rs]) <= 0) },
+	"bgtz": func(c *CPU, f isa.Fields, res *ExecResult) { c.branch(f, int32(c.Regs[f.Rs]) > 0) },
+	"bltz": func(c *CPU, f isa.Fields, res *ExecResult) { c.branch(f, int32(c.Regs[f.Rs]) < 0) },
+	"bgez": func(c *CPU, f isa.Fields, res *ExecResult) { c.branch(f, int32(c.Regs[f.Rs]) >= 0) },
+	// bltzal/bgezal 与 jal 相同，不论是否跳转都写 $ra
+	"bltzal": func(c *CPU, f isa.Fields, res *ExecResult) {
+		cond := int32(c.Regs[f.Rs]) < 0
+		c.setReg(res, 31, c.PC+4)
+		c.branch(f, cond)
+	},
+	"bgezal": func(c *CPU, f isa.Fields, res *ExecResult) {
+		cond := int32(c.Regs[f.Rs]) >= 0
+		c.setReg(res, 31, c.PC+4)
+		c.branch(f, cond)
+	},
+
+	// 访存，内存按大端序以字存放
+	"lb": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		val := c.Mem[a&^3] >> ((3 - (a % 4)) * 8) & 0xFF
 		if val&0x80 != 0 {
 			val |= 0xFFFFFF00
 		}
-		c.Regs[rt] = val
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x21: // lh
-		addrCalc := c.Regs[rs] + immSe
-		val := c.Mem[addrCalc&^3] >> ((2 - (addrCalc % 4)) * 8) & 0xFFFF
+		c.setReg(res, f.Rt, val)
+	},
+	"lbu": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		c.setReg(res, f.Rt, c.Mem[a&^3]>>((3-(a%4))*8)&0xFF)
+	},
+	"lh": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		val := c.Mem[a&^3] >> ((2 - (a % 4)) * 8) & 0xFFFF
 		if val&0x8000 != 0 {
 			val |= 0xFFFF0000
 		}
-		c.Regs[rt] = val
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x23: // lw
-		addrCalc := c.Regs[rs] + immSe
-		c.Regs[rt] = c.Mem[addrCalc]
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x24: // lbu
-		addrCalc := c.Regs[rs] + immSe
-		c.Regs[rt] = c.Mem[addrCalc&^3] >> ((3 - (addrCalc % 4)) * 8) & 0xFF
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x25: // lhu
-		addrCalc := c.Regs[rs] + immSe
-		c.Regs[rt] = c.Mem[addrCalc&^3] >> ((2 - (addrCalc % 4)) * 8) & 0xFFFF
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x28: // sb
-		addrCalc := c.Regs[rs] + immSe
-		shift := (3 - (addrCalc % 4)) * 8
+		c.setReg(res, f.Rt, val)
+	},
+	"lhu": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		c.setReg(res, f.Rt, c.Mem[a&^3]>>((2-(a%4))*8)&0xFFFF)
+	},
+	"lw": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rt, c.Mem[c.ea(f)]) },
+	// lwl：从地址起到所在字末尾的字节装入 rt 的高位
+	"lwl": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		shift := (a % 4) * 8
+		keep := uint32(1)<<shift - 1
+		c.setReg(res, f.Rt, c.Mem[a&^3]<<shift|c.Regs[f.Rt]&keep)
+	},
+	// lwr：从所在字开头到地址的字节装入 rt 的低位
+	"lwr": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		shift := (3 - a%4) * 8
+		keep := ^(uint32(0xFFFFFFFF) >> shift)
+		c.setReg(res, f.Rt, c.Mem[a&^3]>>shift|c.Regs[f.Rt]&keep)
+	},
+	"sb": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		shift := (3 - (a % 4)) * 8
 		mask := ^(uint32(0xFF) << shift)
-		c.Mem[addrCalc&^3] = (c.Mem[addrCalc&^3] & mask) | ((c.Regs[rt] & 0xFF) << shift)
-		res.MemWrite = true
-		res.MemDest = addrCalc
-		res.MemWriteData = c.Regs[rt] & 0xFF
-	case 0x29: // sh
-		addrCalc := c.Regs[rs] + immSe
-		shift := (2 - (addrCalc % 4)) * 8
+		c.store(res, a&^3, (c.Mem[a&^3]&mask)|((c.Regs[f.Rt]&0xFF)<<shift), a, c.Regs[f.Rt]&0xFF)
+	},
+	"sh": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		shift := (2 - (a % 4)) * 8
 		mask := ^(uint32(0xFFFF) << shift)
-		c.Mem[addrCalc&^3] = (c.Mem[addrCalc&^3] & mask) | ((c.Regs[rt] & 0xFFFF) << shift)
-		res.MemWrite = true
-		res.MemDest = addrCalc
-		res.MemWriteData = c.Regs[rt] & 0xFFFF
-	case 0x2B: // sw
-		addrCalc := c.Regs[rs] + immSe
-		c.Mem[addrCalc] = c.Regs[rt]
-		res.MemWrite = true
-		res.MemDest = addrCalc
-		res.MemWriteData = c.Regs[rt]
-	case 0x0A: // slti
-		if int32(c.Regs[rs]) < int32(immSe) {
-			c.Regs[rt] = 1
-		} else {
-			c.Regs[rt] = 0
-		}
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
-		}
-	case 0x0B: // sltiu
-		if c.Regs[rs] < immSe {
-			c.Regs[rt] = 1
-		} else {
-			c.Regs[rt] = 0
-		}
-		if rt != 0 {
-			res.RegWrite = true
-			res.RegDest = rt
-			res.RegWriteData = c.Regs[rt]
+		c.store(res, a&^3, (c.Mem[a&^3]&mask)|((c.Regs[f.Rt]&0xFFFF)<<shift), a, c.Regs[f.Rt]&0xFFFF)
+	},
+	"sw": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		c.store(res, a, c.Regs[f.Rt], a, c.Regs[f.Rt])
+	},
+	// swl：rt 的高位写入从地址起到所在字末尾的字节
+	"swl": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		shift := (a % 4) * 8
+		mask := uint32(0xFFFFFFFF) >> shift
+		v := c.Mem[a&^3]&^mask | c.Regs[f.Rt]>>shift
+		c.store(res, a&^3, v, a&^3, v)
+	},
+	// swr：rt 的低位写入从所在字开头到地址的字节
+	"swr": func(c *CPU, f isa.Fields, res *ExecResult) {
+		a := c.ea(f)
+		shift := (3 - a%4) * 8
+		mask := uint32(0xFFFFFFFF) << shift
+		v := c.Mem[a&^3]&^mask | c.Regs[f.Rt]<<shift
+		c.store(res, a&^3, v, a&^3, v)
+	},
+
+	// 异常与协处理器 0
+	"syscall": func(c *CPU, f isa.Fields, res *ExecResult) { c.raise(res, excSyscall) },
+	"break":   func(c *CPU, f isa.Fields, res *ExecResult) { c.raise(res, excBreak) },
+	"tge":     func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, int32(c.Regs[f.Rs]) >= int32(c.Regs[f.Rt])) },
+	"tgeu":    func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] >= c.Regs[f.Rt]) },
+	"tlt":     func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, int32(c.Regs[f.Rs]) < int32(c.Regs[f.Rt])) },
+	"tltu":    func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] < c.Regs[f.Rt]) },
+	"teq":     func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] == c.Regs[f.Rt]) },
+	"tne":     func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] != c.Regs[f.Rt]) },
+	"tgei": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.trap(res, int32(c.Regs[f.Rs]) >= int32(signExtend16(f.Imm)))
+	},
+	"tgeiu": func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] >= signExtend16(f.Imm)) },
+	"tlti": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.trap(res, int32(c.Regs[f.Rs]) < int32(signExtend16(f.Imm)))
+	},
+	"tltiu": func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] < signExtend16(f.Imm)) },
+	"teqi":  func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] == signExtend16(f.Imm)) },
+	"tnei":  func(c *CPU, f isa.Fields, res *ExecResult) { c.trap(res, c.Regs[f.Rs] != signExtend16(f.Imm)) },
+	"eret": func(c *CPU, f isa.Fields, res *ExecResult) {
+		c.NextPC = c.CP0[14]
+		c.CP0[12] &^= 0x2
+	},
+	"mfc0": func(c *CPU, f isa.Fields, res *ExecResult) { c.setReg(res, f.Rt, c.CP0[f.Rd]) },
+	"mtc0": func(c *CPU, f isa.Fields, res *ExecResult) { c.CP0[f.Rd] = c.Regs[f.Rt] },
+}
+
+// Implemented 报告仿真器是否实现了名为 name 的指令
+func Implemented(name string) bool {
+	_, ok := semantics[name]
+	return ok
+}
+
+// Execute 执行一条指令。指令由 isa.Decode 识别后按助记符分派到 semantics，
+// 无法识别的指令不产生任何效果。
+func (c *CPU) Execute(instrHex uint32) ExecResult {
+	res := ExecResult{}
+	defer func() { c.Regs[0] = 0 }()
+
+	if spec := isa.Decode(instrHex); spec != nil {
+		if exec, ok := semantics[spec.Name]; ok {
+			exec(c, isa.Split(instrHex), &res)
 		}
 	}
-
 	return res
 }
@@ -0,0 +1,58 @@
+package cpu
+
+import (
+	"testing"
+
+	"isa"
+)
+
+// TestImplemented 确认 isa 表中的每条指令都有执行语义，且执行时不会出错
+func TestImplemented(t *testing.T) {
+	for i := range isa.Instructions {
+		s := &isa.Instructions[i]
+		if !Implemented(s.Name) {
+			t.Errorf("仿真器未实现 %s", s.Name)
+			continue
+		}
+		// rs=$t1、rt=$t2、rd=$t0、shamt=3、imm=4
+		c := New()
+		c.NextPC = c.PC + 4
+		c.Execute(s.Match | (9<<21|10<<16|8<<11|3<<6|4)&s.Syntax.Operands())
+	}
+}
+
+func TestExecute(t *testing.T) {
+	cases := []struct {
+		name string
+		word uint32
+		reg  uint32 // 检查的寄存器
+		want uint32
+	}{
+		{"addu $t0, $t1, $t2", 0x012a4021, 8, 0x10000005},
+		{"mul $t0, $t1, $t2", 0x712a4002, 8, 0x50000000},
+		{"clz $t0, $t1", 0x71204020, 8, 3},
+		{"movz $t0, $t1, $zero", 0x0120400a, 8, 0x10000000},
+		{"movn $t0, $t1, $zero", 0x0120400b, 8, 0},
+		{"sra $t0, $t3, 4", 0x000b4103, 8, 0xf8000000},
+		{"lui $t0, 0x1234", 0x3c081234, 8, 0x12340000},
+		{"lw $t0, 4($zero)", 0x8c080004, 8, 0xcafe},
+		{"jal", 0x0c000c10, 31, 0x3004},
+	}
+	for _, c := range cases {
+		cpu := New()
+		cpu.NextPC = cpu.PC + 4
+		cpu.Regs[9], cpu.Regs[10], cpu.Regs[11] = 0x10000000, 5, 0x80000000
+		cpu.Mem[4] = 0xcafe
+		cpu.Execute(c.word)
+		if cpu.Regs[c.reg] != c.want {
+			t.Errorf("%s: $%d = %#x，期望 %#x", c.name, c.reg, cpu.Regs[c.reg], c.want)
+		}
+	}
+
+	// 条件成立的自陷产生异常
+	cpu := New()
+	cpu.NextPC = cpu.PC + 4
+	if res := cpu.Execute(0x00000034); !res.Exception || res.ExcCode != 13 {
+		t.Errorf("teq $zero, $zero 应产生自陷: %+v", res)
+	}
+}
@@ -1,3 +1,17 @@
 module mipsim
 
 go 1.24.0
+
+require (
+	hex2mips v0.0.0
+	isa v0.0.0
+	memcfg v0.0.0
+	mips2hex v0.0.0
+)
+
+replace (
+	hex2mips => ../hex2mips
+	isa => ../isa
+	memcfg => ../memcfg
+	mips2hex => ../mips2hex
+)
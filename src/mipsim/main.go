@@ -8,12 +8,17 @@ import (
 	"strconv"
 	"strings"
 
+	"memcfg"
+	"mips2hex/assembler"
+	"mips2hex/diag"
 	"mipsim/cpu"
 )
 
 func main() {
-	fileFlag := flag.String("f", "", "hex instruction file (each line a 32-bit word, optionally 0x prefix)")
+	fileFlag := flag.String("f", "", "hex instruction file (each line a 32-bit word, optionally 0x prefix), or a .s/.asm source assembled with the -mem layout")
 	limitFlag := flag.Int("limit", 10000, "max execution steps (prevent infinite loop)")
+	dataFlag := flag.String("d", "", "hex data segment image loaded at the .data base of -mem (same format as -f)")
+	memFlag := flag.String("mem", "course", "memory configuration (PC, .data base, $gp, $sp). "+memcfg.Usage())
 	flag.Parse()
 
 	if *fileFlag == "" {
@@ -21,14 +26,63 @@ func main() {
 		os.Exit(1)
 	}
 
-	file, err := os.Open(*fileFlag)
+	cfg, err := memcfg.Lookup(*memFlag)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "open file error: %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	defer file.Close()
 
+	c := cpu.NewConfig(cfg)
 	var instrs []uint32
+	if assembler.IsSource(*fileFlag) {
+		// 汇编源文件按 -mem 布局汇编，跟踪输出附上每条指令的源码行
+		prog, diags := assembler.AssembleFile(*fileFlag, assembler.Options{
+			Layout: assembler.Layout{TextBase: cfg.TextBase, DataBase: cfg.DataBase},
+			Mode:   assembler.CheckWarn,
+		})
+		diag.Print(os.Stderr, diags)
+		if diags.HasErrors() {
+			os.Exit(1)
+		}
+		instrs = prog.Text
+		c.LoadData(cfg.DataBase, prog.Data)
+		c.Annotate = func(pc uint32) string {
+			if s, ok := prog.Source(pc); ok {
+				return s.String()
+			}
+			return ""
+		}
+	} else {
+		instrs, err = readHexFile(*fileFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read file error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *dataFlag != "" {
+		data, err := readHexFile(*dataFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "read data file error: %v\n", err)
+			os.Exit(1)
+		}
+		c.LoadData(cfg.DataBase, data)
+	}
+	if *limitFlag > 0 {
+		c.MaxSteps = *limitFlag
+	}
+	c.Run(instrs)
+}
+
+// readHexFile 读取每行一个 32 位十六进制字的文件，跳过空行与无法解析的行
+func readHexFile(path string) ([]uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []uint32
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -41,16 +95,7 @@ func main() {
 			fmt.Fprintf(os.Stderr, "skip invalid hex '%s': %v\n", line, err)
 			continue
 		}
-		instrs = append(instrs, uint32(val))
+		words = append(words, uint32(val))
 	}
-	if err := scanner.Err(); err != nil {
-		fmt.Fprintf(os.Stderr, "read file error: %v\n", err)
-		os.Exit(1)
-	}
-
-	c := cpu.New()
-	if *limitFlag > 0 {
-		c.MaxSteps = *limitFlag
-	}
-	c.Run(instrs)
+	return words, scanner.Err()
 }